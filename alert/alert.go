@@ -0,0 +1,43 @@
+package alert
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+)
+
+var log = logger.For("alert")
+
+const (
+	KindVandalism = "vandalism"
+)
+
+type Alert struct {
+	Kind      string    `json:"kind"`
+	Wiki      string    `json:"wiki"`
+	Title     string    `json:"title"`
+	TitleURL  string    `json:"title_url"`
+	DiffURL   string    `json:"diff_url"`
+	User      string    `json:"user"`
+	Comment   string    `json:"comment"`
+	Summary   string    `json:"summary"`
+	OldLength int       `json:"old_length"`
+	NewLength int       `json:"new_length"`
+	Time      time.Time `json:"time"`
+}
+
+type Sink interface {
+	Send(ctx context.Context, alert Alert) error
+}
+
+type Sinks []Sink
+
+func (s Sinks) Send(ctx context.Context, alert Alert) {
+	for _, sink := range s {
+		if err := sink.Send(ctx, alert); err != nil {
+			log.Error("error while sending alert", "kind", alert.Kind, "wiki", alert.Wiki,
+				"title", alert.Title, "error", err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package alert
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/metrics"
+)
+
+var (
+	meter = metrics.Meter("alert")
+
+	alertsDropped, _ = meter.Int64Counter("alert.dropped",
+		metric.WithDescription("Notifications dropped because the dispatch queue was full, by queue"))
+)
+
+type dispatched[T any] struct {
+	ctx  context.Context
+	item T
+}
+
+// Dispatcher hands alerts or incidents to their sinks on its own goroutine,
+// so a slow webhook or Discord does not hold up the processor. Items
+// arriving while size of them are waiting are dropped.
+type Dispatcher[T any] struct {
+	name  string
+	queue chan dispatched[T]
+	send  func(context.Context, T)
+}
+
+// NewDispatcher returns a dispatcher reporting drops under name.
+func NewDispatcher[T any](name string, size int, send func(context.Context, T)) *Dispatcher[T] {
+	return &Dispatcher[T]{
+		name:  name,
+		queue: make(chan dispatched[T], size),
+		send:  send,
+	}
+}
+
+// Dispatch queues an item without waiting.
+func (d *Dispatcher[T]) Dispatch(ctx context.Context, item T) {
+	select {
+	case d.queue <- dispatched[T]{ctx: ctx, item: item}:
+	default:
+		log.Warn("dispatch queue full, dropping notification", "queue", d.name)
+		alertsDropped.Add(ctx, 1, metric.WithAttributes(attribute.String("queue", d.name)))
+	}
+}
+
+// Run sends the queued items until Close was called and the queue is empty.
+// Sends are cancelled with ctx, they keep the trace of the event that raised
+// them.
+func (d *Dispatcher[T]) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for queued := range d.queue {
+		d.send(trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(queued.ctx)), queued.item)
+	}
+}
+
+// Close stops taking items, Dispatch must not be called afterwards.
+func (d *Dispatcher[T]) Close() {
+	close(d.queue)
+}
@@ -0,0 +1,239 @@
+package alert
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+)
+
+var revertComment = regexp.MustCompile(`(?i)(undid revision|\brevert(ed)?\b|\bundo\b|\brv\b|\brvv\b)`)
+
+type EditWarConfig struct {
+	Window     time.Duration
+	MinReverts int
+	MaxUsers   int
+}
+
+type pageEdit struct {
+	user     string
+	revision int64
+	length   int
+	revert   bool
+	at       int64
+}
+
+type pageHistory struct {
+	titleURL string
+	edits    []pageEdit
+	reported int64
+}
+
+// EditWar flags pages where a small set of users keep undoing each other
+// within the configured window.
+type EditWar struct {
+	config EditWarConfig
+	db     storage.StorageI
+
+	mu     sync.Mutex
+	pages  map[string]*pageHistory
+	latest int64
+
+	OnIncident func(context.Context, models.EditWarIncident)
+}
+
+func NewEditWar(config EditWarConfig, db storage.StorageI) *EditWar {
+	return &EditWar{
+		config: config,
+		db:     db,
+		pages:  make(map[string]*pageHistory),
+	}
+}
+
+// SetConfig swaps the detection rules, edits already seen are kept and judged
+// by the new rules from the next edit on.
+func (d *EditWar) SetConfig(config EditWarConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.config = config
+}
+
+func (d *EditWar) Observe(ctx context.Context, e models.WikiRecentChanges) {
+	if e.Type != "edit" {
+		return
+	}
+
+	incident, ok := d.observe(e)
+	if !ok {
+		return
+	}
+
+	if _, err := d.db.EditWar().Create(ctx, incident); err != nil {
+		log.Error("error while saving edit war incident", "wiki", incident.Wiki,
+			"title", incident.Title, "error", err)
+	}
+
+	if d.OnIncident != nil {
+		d.OnIncident(ctx, incident)
+	}
+}
+
+func (d *EditWar) observe(e models.WikiRecentChanges) (models.EditWarIncident, bool) {
+	var (
+		at  = int64(e.Timestamp)
+		key = e.ServerName + "|" + e.Title
+	)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	window := int64(d.config.Window / time.Second)
+
+	if at > d.latest {
+		d.latest = at
+	}
+
+	page, ok := d.pages[key]
+	if !ok {
+		page = &pageHistory{}
+		d.pages[key] = page
+	}
+
+	page.prune(at - window)
+	page.titleURL = e.TitleURL
+	page.edits = append(page.edits, pageEdit{
+		user:     e.User,
+		revision: e.Revision.New,
+		length:   e.Length.New,
+		revert:   revertComment.MatchString(e.Comment) || page.restores(e.User, e.Length.New),
+		at:       at,
+	})
+
+	if page.reported > at-window {
+		return models.EditWarIncident{}, false
+	}
+
+	users := map[string]bool{}
+	reverters := map[string]bool{}
+	reverts := 0
+
+	for _, edit := range page.edits {
+		users[edit.user] = true
+
+		if edit.revert {
+			reverts++
+			reverters[edit.user] = true
+		}
+	}
+
+	if reverts < d.config.MinReverts || len(reverters) < 2 || len(users) > d.config.MaxUsers {
+		return models.EditWarIncident{}, false
+	}
+
+	page.reported = at
+
+	incident := models.EditWarIncident{
+		Wiki:       e.ServerName,
+		Title:      e.Title,
+		TitleURL:   page.titleURL,
+		Reverts:    reverts,
+		StartedAt:  time.Unix(page.edits[0].at, 0).UTC(),
+		DetectedAt: time.Unix(at, 0).UTC(),
+	}
+
+	for user := range users {
+		incident.Users = append(incident.Users, user)
+	}
+
+	sort.Strings(incident.Users)
+
+	for _, edit := range page.edits {
+		incident.Revisions = append(incident.Revisions, edit.revision)
+	}
+
+	return incident, true
+}
+
+func (d *EditWar) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	interval := d.window()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug("context cancelled, stopping edit war detector")
+			return
+		case <-ticker.C:
+			if next := d.sweep(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+func (d *EditWar) window() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.config.Window
+}
+
+// sweep drops edits that left the window and returns the window in use.
+func (d *EditWar) sweep() time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	since := d.latest - int64(d.config.Window/time.Second)
+
+	for key, page := range d.pages {
+		page.prune(since)
+
+		if len(page.edits) == 0 {
+			delete(d.pages, key)
+		}
+	}
+
+	return d.config.Window
+}
+
+func (p *pageHistory) prune(since int64) {
+	i := 0
+	for i < len(p.edits) && p.edits[i].at < since {
+		i++
+	}
+
+	p.edits = p.edits[i:]
+}
+
+// restores reports whether a new page length brings back a size seen before
+// the previous edit by someone else, which is how a plain undo looks when
+// only byte lengths are known.
+func (p *pageHistory) restores(user string, length int) bool {
+	n := len(p.edits)
+	if n < 2 {
+		return false
+	}
+
+	previous := p.edits[n-1]
+	if previous.user == user || previous.length == length {
+		return false
+	}
+
+	for _, edit := range p.edits[:n-1] {
+		if edit.length == length {
+			return true
+		}
+	}
+
+	return false
+}
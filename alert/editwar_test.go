@@ -0,0 +1,174 @@
+package alert
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+// historyStart is when the test page history begins.
+var historyStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// pageChange is an edit to the test page, minutes after historyStart.
+type pageChange struct {
+	user    string
+	comment string
+	length  int
+	minute  int
+}
+
+func testEditWar() *EditWar {
+	return NewEditWar(EditWarConfig{Window: 10 * time.Minute, MinReverts: 3, MaxUsers: 3}, nil)
+}
+
+// observeChanges feeds the changes in order and returns the indexes of the
+// changes that raised an incident.
+func observeChanges(d *EditWar, changes []pageChange) ([]int, []models.EditWarIncident) {
+	var (
+		raised    []int
+		incidents []models.EditWarIncident
+	)
+
+	for i, change := range changes {
+		incident, ok := d.observe(models.WikiRecentChanges{
+			Type:       "edit",
+			ServerName: "en.wikipedia.org",
+			Title:      "Page",
+			User:       change.user,
+			Comment:    change.comment,
+			Timestamp:  int(historyStart.Add(time.Duration(change.minute) * time.Minute).Unix()),
+			Length:     models.WikiRecentChangesLength{New: change.length},
+			Revision:   models.Revision{New: int64(i + 1)},
+		})
+		if ok {
+			raised = append(raised, i)
+			incidents = append(incidents, incident)
+		}
+	}
+
+	return raised, incidents
+}
+
+func TestEditWarObserve(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes []pageChange
+		want    []int
+	}{
+		{
+			name: "reverts below the threshold",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "Undid revision 1"}, {user: "A", comment: "rv"},
+			},
+		},
+		{
+			name: "reverts reaching the threshold",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "Undid revision 1"}, {user: "A", comment: "rv"},
+				{user: "B", comment: "Reverted edits"},
+			},
+			want: []int{3},
+		},
+		{
+			name: "a single reverter",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "rv"}, {user: "B", comment: "rv"}, {user: "B", comment: "rv"},
+			},
+		},
+		{
+			name: "too many users",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "rv"}, {user: "C", comment: "rv"}, {user: "D", comment: "rv"},
+			},
+		},
+		{
+			name: "comments that are not reverts",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "copyedit"}, {user: "A", comment: "prevent typos"},
+				{user: "B", comment: "reverse order"},
+			},
+		},
+		{
+			name: "restored lengths count as reverts",
+			changes: []pageChange{
+				{user: "A", length: 100}, {user: "B", length: 50}, {user: "A", length: 100},
+				{user: "B", length: 50}, {user: "A", length: 100},
+			},
+			want: []int{4},
+		},
+		{
+			name: "reverts spread past the window",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "rv", minute: 1}, {user: "A", comment: "rv", minute: 2},
+				{user: "B", comment: "rv", minute: 13},
+			},
+		},
+		{
+			name: "reported once per window",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "rv"}, {user: "A", comment: "rv"},
+				{user: "B", comment: "rv"}, {user: "A", comment: "rv", minute: 5},
+			},
+			want: []int{3},
+		},
+		{
+			name: "reported again after the window",
+			changes: []pageChange{
+				{user: "A"}, {user: "B", comment: "rv"}, {user: "A", comment: "rv"},
+				{user: "B", comment: "rv"}, {user: "A", comment: "rv", minute: 11},
+				{user: "B", comment: "rv", minute: 11}, {user: "A", comment: "rv", minute: 12},
+			},
+			want: []int{3, 6},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _ := observeChanges(testEditWar(), tt.changes); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("incidents raised at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEditWarIncident(t *testing.T) {
+	_, incidents := observeChanges(testEditWar(), []pageChange{
+		{user: "A", minute: 0}, {user: "B", comment: "rv", minute: 1}, {user: "A", comment: "rv", minute: 2},
+		{user: "B", comment: "rv", minute: 3},
+	})
+	if len(incidents) != 1 {
+		t.Fatalf("raised %d incidents, want 1", len(incidents))
+	}
+
+	incident := incidents[0]
+
+	if fmt.Sprint(incident.Users) != "[A B]" || incident.Reverts != 3 ||
+		fmt.Sprint(incident.Revisions) != "[1 2 3 4]" {
+		t.Errorf("incident = %+v", incident)
+	}
+
+	if detected := historyStart.Add(3 * time.Minute); !incident.StartedAt.Equal(historyStart) ||
+		!incident.DetectedAt.Equal(detected) {
+		t.Errorf("incident ran from %v to %v, want %v to %v", incident.StartedAt, incident.DetectedAt,
+			historyStart, detected)
+	}
+}
+
+func TestEditWarSweep(t *testing.T) {
+	d := testEditWar()
+	observeChanges(d, []pageChange{{user: "A"}})
+
+	d.observe(models.WikiRecentChanges{Type: "edit", ServerName: "en.wikipedia.org", Title: "Other",
+		Timestamp: int(historyStart.Add(11 * time.Minute).Unix())})
+	d.sweep()
+
+	if _, ok := d.pages["en.wikipedia.org|Page"]; ok {
+		t.Error("page without edits in the window was kept")
+	}
+
+	if _, ok := d.pages["en.wikipedia.org|Other"]; !ok {
+		t.Error("page with edits in the window was dropped")
+	}
+}
@@ -0,0 +1,131 @@
+package alert
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+const defaultThresholdKey = "default"
+
+type VandalismConfig struct {
+	// Thresholds maps a server name to the number of removed bytes that
+	// triggers an alert, the "default" key applies to every other wiki.
+	Thresholds map[string]int
+}
+
+// Vandalism fires on large removals made by anonymous, temporary or
+// not yet trusted accounts.
+type Vandalism struct {
+	mu     sync.RWMutex
+	config VandalismConfig
+	// patrolling holds the wikis seen marking edits as patrolled, the
+	// patrolled flag is always false on the others.
+	patrolling map[string]bool
+
+	OnAlert func(context.Context, Alert)
+}
+
+func NewVandalism(config VandalismConfig) *Vandalism {
+	return &Vandalism{
+		config:     config,
+		patrolling: make(map[string]bool),
+	}
+}
+
+func (v *Vandalism) SetConfig(config VandalismConfig) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.config = config
+}
+
+func (v *Vandalism) Observe(ctx context.Context, e models.WikiRecentChanges) {
+	if e.Type != "edit" || e.Bot {
+		return
+	}
+
+	if e.Patrolled {
+		v.markPatrolling(e.ServerName)
+	}
+
+	threshold := v.threshold(e.ServerName)
+	removed := -e.ByteDelta()
+
+	if threshold <= 0 || removed < threshold {
+		return
+	}
+
+	// registered users only count as untrusted where edits get patrolled
+	if !IsAnonymous(e.User) && (e.Patrolled || !v.usesPatrolling(e.ServerName)) {
+		return
+	}
+
+	if v.OnAlert != nil {
+		v.OnAlert(ctx, Alert{
+			Kind:      KindVandalism,
+			Wiki:      e.ServerName,
+			Title:     e.Title,
+			TitleURL:  e.TitleURL,
+			DiffURL:   diffURL(e),
+			User:      e.User,
+			Comment:   e.Comment,
+			Summary:   fmt.Sprintf("%d bytes removed", removed),
+			OldLength: e.Length.Old,
+			NewLength: e.Length.New,
+			Time:      e.Time(),
+		})
+	}
+}
+
+func (v *Vandalism) markPatrolling(wiki string) {
+	v.mu.RLock()
+	known := v.patrolling[wiki]
+	v.mu.RUnlock()
+
+	if known {
+		return
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.patrolling[wiki] = true
+}
+
+func (v *Vandalism) usesPatrolling(wiki string) bool {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	return v.patrolling[wiki]
+}
+
+func (v *Vandalism) threshold(wiki string) int {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+
+	if threshold, ok := v.config.Thresholds[wiki]; ok {
+		return threshold
+	}
+
+	return v.config.Thresholds[defaultThresholdKey]
+}
+
+// IsAnonymous reports whether a username is an IP address or a temporary
+// account, which MediaWiki names with a leading tilde.
+func IsAnonymous(user string) bool {
+	return net.ParseIP(user) != nil || strings.HasPrefix(user, "~")
+}
+
+func diffURL(e models.WikiRecentChanges) string {
+	if e.ServerURL == "" || e.Revision.New == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s%s/index.php?diff=%d&oldid=%d",
+		e.ServerURL, e.ServerScriptPath, e.Revision.New, e.Revision.Old)
+}
@@ -0,0 +1,139 @@
+package alert
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+const (
+	patrollingWiki = "en.wikipedia.org"
+	plainWiki      = "xx.wikipedia.org"
+)
+
+func removal(wiki, user string, removed int) models.WikiRecentChanges {
+	return models.WikiRecentChanges{
+		Type:       "edit",
+		ServerName: wiki,
+		Title:      "Page",
+		User:       user,
+		Length:     models.WikiRecentChangesLength{Old: 10000, New: 10000 - removed},
+	}
+}
+
+func TestVandalismObserve(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func() models.WikiRecentChanges
+		alert  bool
+	}{
+		{"anonymous IPv4 over the threshold", func() models.WikiRecentChanges {
+			return removal(plainWiki, "192.0.2.1", 3000)
+		}, true},
+		{"anonymous IPv6 over the threshold", func() models.WikiRecentChanges {
+			return removal(plainWiki, "2001:db8::1", 3000)
+		}, true},
+		{"temporary account over the threshold", func() models.WikiRecentChanges {
+			return removal(plainWiki, "~2025-12345-6", 3000)
+		}, true},
+		{"anonymous exactly at the threshold", func() models.WikiRecentChanges {
+			return removal(plainWiki, "192.0.2.1", 2000)
+		}, true},
+		{"anonymous under the threshold", func() models.WikiRecentChanges {
+			return removal(plainWiki, "192.0.2.1", 1999)
+		}, false},
+		{"anonymous under a per wiki threshold", func() models.WikiRecentChanges {
+			return removal(patrollingWiki, "192.0.2.1", 3000)
+		}, false},
+		{"anonymous addition", func() models.WikiRecentChanges {
+			return removal(plainWiki, "192.0.2.1", -3000)
+		}, false},
+		{"bot", func() models.WikiRecentChanges {
+			e := removal(plainWiki, "192.0.2.1", 3000)
+			e.Bot = true
+
+			return e
+		}, false},
+		{"not an edit", func() models.WikiRecentChanges {
+			e := removal(plainWiki, "192.0.2.1", 3000)
+			e.Type = "new"
+
+			return e
+		}, false},
+		{"unpatrolled registered user on a patrolling wiki", func() models.WikiRecentChanges {
+			return removal(patrollingWiki, "Someone", 6000)
+		}, true},
+		{"patrolled registered user on a patrolling wiki", func() models.WikiRecentChanges {
+			e := removal(patrollingWiki, "Someone", 6000)
+			e.Patrolled = true
+
+			return e
+		}, false},
+		{"registered user on a wiki without patrolling", func() models.WikiRecentChanges {
+			return removal(plainWiki, "Someone", 6000)
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewVandalism(VandalismConfig{Thresholds: map[string]int{
+				defaultThresholdKey: 2000,
+				patrollingWiki:      5000,
+			}})
+
+			var alerts []Alert
+
+			v.OnAlert = func(_ context.Context, a Alert) {
+				alerts = append(alerts, a)
+			}
+
+			// en.wikipedia.org shows it patrols edits
+			patrolled := removal(patrollingWiki, "Trusted", 0)
+			patrolled.Patrolled = true
+			v.Observe(context.Background(), patrolled)
+
+			v.Observe(context.Background(), tt.change())
+
+			if got := len(alerts) == 1; got != tt.alert {
+				t.Fatalf("alerts = %+v, want an alert: %t", alerts, tt.alert)
+			}
+
+			if tt.alert && alerts[0].Kind != KindVandalism {
+				t.Errorf("alert kind = %q, want %q", alerts[0].Kind, KindVandalism)
+			}
+		})
+	}
+}
+
+func TestVandalismDisabledThreshold(t *testing.T) {
+	v := NewVandalism(VandalismConfig{Thresholds: map[string]int{plainWiki: 0}})
+
+	v.OnAlert = func(context.Context, Alert) {
+		t.Error("alert raised without a threshold")
+	}
+
+	v.Observe(context.Background(), removal(plainWiki, "192.0.2.1", 100000))
+}
+
+func TestIsAnonymous(t *testing.T) {
+	tests := []struct {
+		user string
+		want bool
+	}{
+		{"192.0.2.1", true},
+		{"2001:db8::1", true},
+		{"~2025-12345-6", true},
+		{"Someone", false},
+		{"192.0.2", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.user, func(t *testing.T) {
+			if got := IsAnonymous(tt.user); got != tt.want {
+				t.Errorf("IsAnonymous(%q) = %t, want %t", tt.user, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,319 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+)
+
+var log = logger.For("analytics")
+
+const bucketSize = time.Minute
+
+var ErrInvalidWindow = errors.New("window must be at least 1m and shorter than the baseline")
+
+type TrendingConfig struct {
+	Window         time.Duration
+	Baseline       time.Duration
+	MinEdits       int
+	MinScore       float64
+	NotifyInterval time.Duration
+	NotifyLimit    int
+}
+
+type TrendingPage struct {
+	Wiki     string  `json:"wiki"`
+	Title    string  `json:"title"`
+	TitleURL string  `json:"title_url"`
+	Edits    int     `json:"edits"`
+	Expected float64 `json:"expected"`
+	Score    float64 `json:"score"`
+}
+
+type bucket struct {
+	minute int64
+	count  int
+}
+
+type series struct {
+	titleURL string
+	buckets  []bucket
+}
+
+// Trending keeps per-title edit counts for every wiki in one minute buckets and
+// scores the recent window against the rate seen over the rest of the baseline.
+type Trending struct {
+	config TrendingConfig
+
+	mu        sync.Mutex
+	wikis     map[string]map[string]*series
+	latest    int64
+	announced map[string]time.Time
+
+	OnTrending func(context.Context, TrendingPage)
+}
+
+func NewTrending(config TrendingConfig) *Trending {
+	if config.NotifyLimit <= 0 {
+		config.NotifyLimit = 5
+	}
+
+	return &Trending{
+		config:    config,
+		wikis:     make(map[string]map[string]*series),
+		announced: make(map[string]time.Time),
+	}
+}
+
+// NormalizeWiki accepts either a full server name or a bare language prefix,
+// which is expanded to the matching Wikipedia.
+func NormalizeWiki(wiki string) string {
+	wiki = strings.ToLower(strings.TrimSpace(wiki))
+	if wiki != "" && !strings.Contains(wiki, ".") {
+		wiki += ".wikipedia.org"
+	}
+
+	return wiki
+}
+
+// SetConfig swaps the thresholds and windows while keeping the counted
+// edits, a longer baseline fills up as new edits arrive.
+func (t *Trending) SetConfig(config TrendingConfig) {
+	if config.NotifyLimit <= 0 {
+		config.NotifyLimit = 5
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.config = config
+}
+
+func (t *Trending) DefaultWindow() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.config.Window
+}
+
+func (t *Trending) Observe(e models.WikiRecentChanges) {
+	if e.Type != "edit" && e.Type != "new" {
+		return
+	}
+
+	minute := int64(e.Timestamp) / int64(bucketSize/time.Second)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	titles, ok := t.wikis[e.ServerName]
+	if !ok {
+		titles = make(map[string]*series)
+		t.wikis[e.ServerName] = titles
+	}
+
+	s, ok := titles[e.Title]
+	if !ok {
+		s = &series{}
+		titles[e.Title] = s
+	}
+
+	s.titleURL = e.TitleURL
+	s.add(minute)
+
+	if minute > t.latest {
+		t.latest = minute
+	}
+}
+
+func (t *Trending) Top(wiki string, window time.Duration, limit int) ([]TrendingPage, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if window == 0 {
+		window = t.config.Window
+	}
+
+	if window < bucketSize || window >= t.config.Baseline {
+		return nil, ErrInvalidWindow
+	}
+
+	return t.top(NormalizeWiki(wiki), window, limit), nil
+}
+
+func (t *Trending) top(wiki string, window time.Duration, limit int) []TrendingPage {
+	var (
+		pages         []TrendingPage
+		windowMinutes = int64(window / bucketSize)
+		totalMinutes  = int64(t.config.Baseline / bucketSize)
+		ratio         = float64(windowMinutes) / float64(totalMinutes-windowMinutes)
+		windowStart   = t.latest - windowMinutes
+		baselineStart = t.latest - totalMinutes
+	)
+
+	for title, s := range t.wikis[wiki] {
+		recent, past := s.split(baselineStart, windowStart)
+		if recent < t.config.MinEdits {
+			continue
+		}
+
+		expected := float64(past) * ratio
+		score := (float64(recent) - expected) / math.Sqrt(expected+1)
+
+		if score < t.config.MinScore {
+			continue
+		}
+
+		pages = append(pages, TrendingPage{
+			Wiki:     wiki,
+			Title:    title,
+			TitleURL: s.titleURL,
+			Edits:    recent,
+			Expected: expected,
+			Score:    score,
+		})
+	}
+
+	sort.Slice(pages, func(i, j int) bool {
+		return pages[i].Score > pages[j].Score
+	})
+
+	if limit > 0 && len(pages) > limit {
+		pages = pages[:limit]
+	}
+
+	return pages
+}
+
+func (t *Trending) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	interval := t.notifyInterval()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug("context cancelled, stopping trending tracker")
+			return
+		case <-ticker.C:
+			for _, page := range t.tick() {
+				if t.OnTrending != nil {
+					t.OnTrending(ctx, page)
+				}
+			}
+
+			if next := t.notifyInterval(); next != interval {
+				interval = next
+				ticker.Reset(interval)
+			}
+		}
+	}
+}
+
+func (t *Trending) notifyInterval() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.config.NotifyInterval
+}
+
+// tick drops expired buckets and returns pages that started trending since
+// they were last announced.
+func (t *Trending) tick() []TrendingPage {
+	var fresh []TrendingPage
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	baselineStart := t.latest - int64(t.config.Baseline/bucketSize)
+
+	for wiki, titles := range t.wikis {
+		for title, s := range titles {
+			if !s.prune(baselineStart) {
+				delete(titles, title)
+			}
+		}
+
+		if len(titles) == 0 {
+			delete(t.wikis, wiki)
+			continue
+		}
+
+		for _, page := range t.top(wiki, t.config.Window, t.config.NotifyLimit) {
+			key := page.Wiki + "|" + page.Title
+			if _, ok := t.announced[key]; ok {
+				continue
+			}
+
+			t.announced[key] = time.Now()
+
+			fresh = append(fresh, page)
+		}
+	}
+
+	for key, at := range t.announced {
+		if time.Since(at) > t.config.Baseline {
+			delete(t.announced, key)
+		}
+	}
+
+	return fresh
+}
+
+func (s *series) add(minute int64) {
+	n := len(s.buckets)
+	if n > 0 && s.buckets[n-1].minute == minute {
+		s.buckets[n-1].count++
+		return
+	}
+
+	// events arrive almost in order, so an out of order minute is searched
+	// backwards from the tail
+	i := n
+	for i > 0 && s.buckets[i-1].minute > minute {
+		i--
+	}
+
+	if i > 0 && s.buckets[i-1].minute == minute {
+		s.buckets[i-1].count++
+		return
+	}
+
+	s.buckets = append(s.buckets, bucket{})
+	copy(s.buckets[i+1:], s.buckets[i:])
+	s.buckets[i] = bucket{minute: minute, count: 1}
+}
+
+func (s *series) split(baselineStart, windowStart int64) (recent, past int) {
+	for _, b := range s.buckets {
+		switch {
+		case b.minute > windowStart:
+			recent += b.count
+		case b.minute > baselineStart:
+			past += b.count
+		}
+	}
+
+	return recent, past
+}
+
+func (s *series) prune(baselineStart int64) bool {
+	i := 0
+	for i < len(s.buckets) && s.buckets[i].minute <= baselineStart {
+		i++
+	}
+
+	s.buckets = s.buckets[i:]
+
+	return len(s.buckets) > 0
+}
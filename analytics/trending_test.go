@@ -0,0 +1,188 @@
+package analytics
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+const testWiki = "en.wikipedia.org"
+
+// edits is a number of edits to a page in one minute.
+type edits struct {
+	title  string
+	minute int
+	count  int
+}
+
+func testConfig() TrendingConfig {
+	return TrendingConfig{
+		Window:         10 * time.Minute,
+		Baseline:       time.Hour,
+		MinEdits:       3,
+		MinScore:       2,
+		NotifyInterval: time.Minute,
+		NotifyLimit:    2,
+	}
+}
+
+func observe(t *Trending, batches ...edits) {
+	for _, batch := range batches {
+		for i := 0; i < batch.count; i++ {
+			t.Observe(models.WikiRecentChanges{
+				Type:       "edit",
+				ServerName: testWiki,
+				Title:      batch.title,
+				Timestamp:  batch.minute * 60,
+			})
+		}
+	}
+}
+
+// steady edits a page once a minute for an hour.
+func steady(title string) []edits {
+	batches := make([]edits, 0, 60)
+	for minute := 0; minute < 60; minute++ {
+		batches = append(batches, edits{title, minute, 1})
+	}
+
+	return batches
+}
+
+func describe(pages []TrendingPage) string {
+	var described []string
+	for _, page := range pages {
+		described = append(described, fmt.Sprintf("%s: %d edits, %.1f expected, score %.1f",
+			page.Title, page.Edits, page.Expected, page.Score))
+	}
+
+	return fmt.Sprint(described)
+}
+
+func TestTrendingTop(t *testing.T) {
+	tests := []struct {
+		name  string
+		edits []edits
+		limit int
+		want  []string
+	}{
+		{
+			name:  "burst without history",
+			edits: []edits{{"Burst", 0, 5}},
+			want:  []string{"Burst: 5 edits, 0.0 expected, score 5.0"},
+		},
+		{
+			name:  "below min edits",
+			edits: []edits{{"Quiet", 0, 2}},
+		},
+		{
+			name:  "steady rate",
+			edits: steady("Steady"),
+		},
+		{
+			name:  "burst above a steady rate",
+			edits: append(steady("Steady"), edits{"Steady", 59, 20}),
+			want:  []string{"Steady: 30 edits, 10.0 expected, score 6.0"},
+		},
+		{
+			name:  "burst left the window",
+			edits: []edits{{"Old", 0, 5}, {"Other", 11, 1}},
+		},
+		{
+			name:  "edits before the baseline are not expected",
+			edits: []edits{{"Back", 0, 50}, {"Back", 70, 5}},
+			want:  []string{"Back: 5 edits, 0.0 expected, score 5.0"},
+		},
+		{
+			name:  "highest score first",
+			edits: []edits{{"Small", 0, 4}, {"Large", 0, 8}},
+			want: []string{
+				"Large: 8 edits, 0.0 expected, score 8.0",
+				"Small: 4 edits, 0.0 expected, score 4.0",
+			},
+		},
+		{
+			name:  "limited",
+			edits: []edits{{"Small", 0, 4}, {"Large", 0, 8}},
+			limit: 1,
+			want:  []string{"Large: 8 edits, 0.0 expected, score 8.0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trending := NewTrending(testConfig())
+			observe(trending, tt.edits...)
+
+			pages, err := trending.Top("en", 0, tt.limit)
+			if err != nil {
+				t.Fatalf("Top: %v", err)
+			}
+
+			if got := describe(pages); got != fmt.Sprint(tt.want) {
+				t.Errorf("Top = %s, want %s", got, fmt.Sprint(tt.want))
+			}
+		})
+	}
+}
+
+func TestTrendingTopWindow(t *testing.T) {
+	tests := []struct {
+		window time.Duration
+		err    error
+	}{
+		{0, nil},
+		{time.Minute, nil},
+		{59 * time.Minute, nil},
+		{30 * time.Second, ErrInvalidWindow},
+		{time.Hour, ErrInvalidWindow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window.String(), func(t *testing.T) {
+			_, err := NewTrending(testConfig()).Top(testWiki, tt.window, 10)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Top(%v) error = %v, want %v", tt.window, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTrendingTick(t *testing.T) {
+	trending := NewTrending(testConfig())
+	observe(trending, edits{"A", 0, 9}, edits{"B", 0, 8}, edits{"C", 0, 7})
+
+	if got, want := describe(trending.tick()), "[A: 9 edits, 0.0 expected, score 9.0 "+
+		"B: 8 edits, 0.0 expected, score 8.0]"; got != want {
+		t.Fatalf("first tick = %s, want %s", got, want)
+	}
+
+	if got := trending.tick(); len(got) != 0 {
+		t.Fatalf("second tick announced %s again", describe(got))
+	}
+
+	// once the announced pages leave the window the next one is announced
+	observe(trending, edits{"C", 11, 7})
+
+	if got, want := describe(trending.tick()), "[C: 7 edits, 1.4 expected, score 3.6]"; got != want {
+		t.Errorf("tick after the window moved = %s, want %s", got, want)
+	}
+}
+
+func TestTrendingTickDropsExpiredPages(t *testing.T) {
+	trending := NewTrending(testConfig())
+	observe(trending, edits{"Old", 0, 5}, edits{"New", 61, 1})
+
+	trending.tick()
+
+	if _, ok := trending.wikis[testWiki]["Old"]; ok {
+		t.Error("page without edits in the baseline was kept")
+	}
+
+	if _, ok := trending.wikis[testWiki]["New"]; !ok {
+		t.Error("page with edits in the baseline was dropped")
+	}
+}
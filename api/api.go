@@ -0,0 +1,270 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/analytics"
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+	"github.com/Sanjar0126/wiki_change_stream/schema"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+	"github.com/spf13/cast"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+var log = logger.For("api")
+
+const (
+	defaultChangesLimit = 10
+	// maxChangesLimit caps the changes returned by one request, larger
+	// limits are lowered to it.
+	maxChangesLimit = 100
+)
+
+type Handler struct {
+	config   *config.Config
+	db       storage.StorageI
+	trending *analytics.Trending
+	schemas  *schema.Registry
+}
+
+type HandlerOptions struct {
+	Config   *config.Config
+	DB       storage.StorageI
+	Trending *analytics.Trending
+	// Schemas is nil when ingest does not run in this process.
+	Schemas *schema.Registry
+}
+
+type changesResponse struct {
+	Changes []*models.WikiRecentChanges `json:"changes"`
+	Count   int32                       `json:"count"`
+}
+
+func NewServer(opts *HandlerOptions) *http.Server {
+	h := &Handler{
+		config:   opts.Config,
+		db:       opts.DB,
+		trending: opts.Trending,
+		schemas:  opts.Schemas,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /changes", h.Changes)
+	mux.HandleFunc("GET /changes/{id}", h.Change)
+	mux.HandleFunc("GET /wikis/{wiki}/changes/{rcid}", h.ChangeByRCID)
+	mux.HandleFunc("GET /wikis/{wiki}/revisions/{revision}", h.ChangeByRevision)
+	mux.HandleFunc("GET /schemas", h.Schemas)
+	mux.HandleFunc("GET /trending", h.Trending)
+
+	handler := otelhttp.NewHandler(mux, "api",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method + " " + r.URL.Path
+		}))
+
+	return &http.Server{
+		Addr:              opts.Config.API.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+func (h *Handler) Changes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	offset, err := queryInt(query, "offset", 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "offset must be a number of 0 or more")
+		return
+	}
+
+	limit, err := queryInt(query, "limit", defaultChangesLimit)
+	if err != nil || limit == 0 {
+		writeError(w, http.StatusBadRequest, "limit must be a number of 1 or more")
+		return
+	}
+
+	limit = min(limit, maxChangesLimit)
+
+	filter := models.WikiChangesFilter{
+		Lang:      query.Get("lang"),
+		Project:   query.Get("project"),
+		Type:      query.Get("type"),
+		LogType:   query.Get("log_type"),
+		LogAction: query.Get("log_action"),
+	}
+
+	// a project alone covers every language of it
+	if filter.Lang == "" && filter.Project == "" {
+		filter.Lang = "en"
+	}
+
+	changes, count, err := h.db.WikiChanges().GetAll(r.Context(), offset, limit, filter)
+	if err != nil {
+		log.Error("error while getting wiki changes from db", "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get changes")
+
+		return
+	}
+
+	if changes == nil {
+		changes = []*models.WikiRecentChanges{}
+	}
+
+	writeJSON(w, http.StatusOK, changesResponse{
+		Changes: changes,
+		Count:   count,
+	})
+}
+
+// Change returns one stored change by its object id or its meta.id.
+func (h *Handler) Change(w http.ResponseWriter, r *http.Request) {
+	var (
+		change *models.WikiRecentChanges
+		err    error
+	)
+
+	id := r.PathValue("id")
+
+	if primitive.IsValidObjectID(id) {
+		change, err = h.db.WikiChanges().Get(r.Context(), id)
+	} else {
+		change, err = h.db.WikiChanges().GetByMetaID(r.Context(), id)
+	}
+
+	h.writeChange(w, r, change, err)
+}
+
+func (h *Handler) ChangeByRCID(w http.ResponseWriter, r *http.Request) {
+	rcID, err := strconv.ParseInt(r.PathValue("rcid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "rcid must be a number")
+		return
+	}
+
+	change, err := h.db.WikiChanges().GetByRCID(
+		r.Context(), analytics.NormalizeWiki(r.PathValue("wiki")), rcID)
+
+	h.writeChange(w, r, change, err)
+}
+
+func (h *Handler) ChangeByRevision(w http.ResponseWriter, r *http.Request) {
+	revision, err := strconv.ParseInt(r.PathValue("revision"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "revision must be a number")
+		return
+	}
+
+	change, err := h.db.WikiChanges().GetByRevision(
+		r.Context(), analytics.NormalizeWiki(r.PathValue("wiki")), revision)
+
+	h.writeChange(w, r, change, err)
+}
+
+func (h *Handler) writeChange(w http.ResponseWriter, r *http.Request,
+	change *models.WikiRecentChanges, err error) {
+	if errors.Is(err, repo.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "change not found")
+		return
+	}
+
+	if err != nil {
+		log.Error("error while getting wiki change from db", "path", r.URL.Path, "error", err)
+		writeError(w, http.StatusInternalServerError, "failed to get change")
+
+		return
+	}
+
+	writeJSON(w, http.StatusOK, change)
+}
+
+func (h *Handler) Trending(w http.ResponseWriter, r *http.Request) {
+	var (
+		window time.Duration
+		err    error
+	)
+
+	query := r.URL.Query()
+
+	wiki := query.Get("wiki")
+	if wiki == "" {
+		wiki = "en"
+	}
+
+	if query.Has("window") {
+		window, err = time.ParseDuration(query.Get("window"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "window must look like 15m or 1h")
+			return
+		}
+	}
+
+	limit := 10
+	if query.Has("limit") {
+		limit = cast.ToInt(query.Get("limit"))
+	}
+
+	pages, err := h.trending.Top(wiki, window, limit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if pages == nil {
+		pages = []analytics.TrendingPage{}
+	}
+
+	writeJSON(w, http.StatusOK, pages)
+}
+
+// Schemas returns the events seen per schema, which only the process running
+// ingest knows.
+func (h *Handler) Schemas(w http.ResponseWriter, r *http.Request) {
+	if h.schemas == nil {
+		writeError(w, http.StatusNotImplemented, "schema counts are only available where ingest runs")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.schemas.Seen())
+}
+
+// queryInt reads a non-negative number from the query, fallback when it is
+// not given.
+func queryInt(query url.Values, name string, fallback int64) (int64, error) {
+	if !query.Has(name) {
+		return fallback, nil
+	}
+
+	value, err := strconv.ParseInt(query.Get(name), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if value < 0 {
+		return 0, fmt.Errorf("%s is negative", name)
+	}
+
+	return value, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Warn("error while writing response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+)
+
+const redacted = "<redacted>"
+
+// runConfig only runs once the configuration loaded and validated, main
+// reports the problems and exits otherwise.
+func runConfig(loaded *config.Config, args []string) error {
+	if len(args) != 1 || args[0] != "check" {
+		return errors.New("usage: config check")
+	}
+
+	cfg := *loaded
+
+	source := cfg.File
+	if source == "" {
+		source = "defaults and environment"
+	}
+
+	fmt.Printf("# configuration is valid, loaded from %s\n", source)
+
+	if cfg.Storage.Password != "" {
+		cfg.Storage.Password = redacted
+	}
+
+	if cfg.Bot.Token != "" {
+		cfg.Bot.Token = redacted
+	}
+
+	// webhook URLs carry their secret token in the path
+	if cfg.Alerts.WebhookURL != "" {
+		cfg.Alerts.WebhookURL = redacted
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(cfg); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/pipeline"
+	"github.com/Sanjar0126/wiki_change_stream/schema"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+)
+
+const dlqPageSize = 100
+
+func runDLQ(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: dlq list|retry|purge")
+	}
+
+	flags := flag.NewFlagSet("dlq "+args[0], flag.ExitOnError)
+	offset := flags.Int64("offset", 0, "dead letters to skip when listing")
+	limit := flags.Int64("limit", 10, "dead letters to list")
+
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	storageDB, disconnect, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	switch args[0] {
+	case "list":
+		return listDeadLetters(ctx, storageDB, *offset, *limit)
+	case "retry":
+		return retryDeadLetters(ctx, storageDB)
+	case "purge":
+		deleted, err := storageDB.DeadLetter().DeleteAll(ctx)
+		if err != nil {
+			return err
+		}
+
+		log.Info("purged dead letters", "deleted", deleted)
+
+		return nil
+	default:
+		return fmt.Errorf("unknown dlq command %q", args[0])
+	}
+}
+
+func listDeadLetters(ctx context.Context, storageDB storage.StorageI, offset, limit int64) error {
+	deadLetters, count, err := storageDB.DeadLetter().GetAll(ctx, offset, limit)
+	if err != nil {
+		return err
+	}
+
+	for _, deadLetter := range deadLetters {
+		fmt.Printf("%s %s %s\n%s\n\n", deadLetter.BId.Hex(),
+			deadLetter.CreatedAt.Format("2006-01-02 15:04:05"), deadLetter.Error, deadLetter.Data)
+	}
+
+	fmt.Printf("Total: %d\n", count)
+
+	return nil
+}
+
+// retryDeadLetters decodes every dead letter again, which helps once a new
+// schema version is supported, and stores the ones that pass. A dead letter
+// is only deleted once its change is stored.
+func retryDeadLetters(ctx context.Context, storageDB storage.StorageI) error {
+	var (
+		offset   int64
+		retried  int
+		rejected int
+		failed   int
+	)
+
+	schemas := schema.NewRegistry()
+
+	for {
+		deadLetters, _, err := storageDB.DeadLetter().GetAll(ctx, offset, dlqPageSize)
+		if err != nil {
+			return err
+		}
+
+		for _, deadLetter := range deadLetters {
+			e, err := schemas.Decode([]byte(deadLetter.Data))
+			if err != nil {
+				rejected++
+				offset++
+
+				continue
+			}
+
+			pipeline.Enrich(&e)
+
+			if err := saveChange(ctx, storageDB, e); err != nil {
+				log.Error("error while saving wiki change, keeping the dead letter",
+					"id", deadLetter.BId.Hex(), "meta.id", e.Meta.ID, "error", err)
+
+				failed++
+				offset++
+
+				continue
+			}
+
+			if err := storageDB.DeadLetter().Delete(ctx, deadLetter.BId.Hex()); err != nil {
+				return err
+			}
+
+			retried++
+		}
+
+		if len(deadLetters) < dlqPageSize || ctx.Err() != nil {
+			break
+		}
+	}
+
+	log.Info("retried dead letters", "retried", retried, "rejected", rejected, "failed", failed)
+
+	if failed > 0 && ctx.Err() == nil {
+		return fmt.Errorf("%d dead letters could not be stored and were kept", failed)
+	}
+
+	return ctx.Err()
+}
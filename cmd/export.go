@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/export"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+func runExport(cfg *config.Config, args []string) error {
+	var (
+		filter models.WikiChangesFilter
+		err    error
+	)
+
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	flags.StringVar(&filter.Lang, "lang", "", "language prefix of the wiki, every wiki when empty")
+	flags.StringVar(&filter.Project, "project", "", "project family, e.g. wikipedia or wiktionary, every project when empty")
+	flags.StringVar(&filter.Type, "type", "", "change type such as edit, new or log")
+	from := flags.String("from", "", "first day or time to export, yyyy-mm-dd or RFC 3339")
+	to := flags.String("to", "", "day or time to stop before, yyyy-mm-dd or RFC 3339")
+	format := flags.String("format", export.FormatNDJSON, "ndjson, csv or parquet")
+	compression := flags.String("compress", export.CompressionNone, "none, gzip or zstd")
+	partition := flags.String("partition", export.PartitionNone, "none, hour or day")
+	out := flags.String("out", "", "output file, or directory when partitioned; stdout when empty")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if filter.From, err = parseTime(*from); err != nil {
+		return err
+	}
+
+	if filter.To, err = parseTime(*to); err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	storageDB, disconnect, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	exporter, err := export.New(export.Options{
+		Format:      *format,
+		Compression: *compression,
+		Partition:   *partition,
+		Out:         *out,
+		Stdout:      os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = storageDB.WikiChanges().Stream(ctx, filter, exporter.Write)
+
+	if closeErr := exporter.Close(); err == nil {
+		err = closeErr
+	}
+
+	log.Info("export finished", "written", exporter.Written())
+
+	return err
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return t, fmt.Errorf("invalid time %q, expected yyyy-mm-dd or RFC 3339", value)
+	}
+
+	return t, nil
+}
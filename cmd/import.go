@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/importer"
+	"github.com/Sanjar0126/wiki_change_stream/schema"
+)
+
+func runImport(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	workers := flags.Int("workers", 4, "parallel bulk writers")
+	batchSize := flags.Int("batch", 500, "changes per bulk write")
+	restart := flags.Bool("restart", false, "ignore the checkpoint and start from the beginning")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		return errors.New("usage: import [flags] <file>...")
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	// the unique meta.id index is what makes importing twice harmless
+	storageDB, disconnect, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	schemas := schema.NewRegistry()
+
+	im := importer.New(storageDB, importer.Options{
+		Workers:   *workers,
+		BatchSize: *batchSize,
+		Resume:    !*restart,
+		Decode:    schemas.Decode,
+		OnReject: func(ctx context.Context, data []byte, err error) {
+			deadLetter(ctx, storageDB, data, err)
+		},
+	})
+
+	for _, path := range flags.Args() {
+		progress, err := im.Import(ctx, path)
+
+		log.Info("import finished", "file", path, "read", progress.Read, "inserted", progress.Inserted,
+			"skipped", progress.Skipped, "rejected", progress.Rejected)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
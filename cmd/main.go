@@ -2,116 +2,270 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
 	"github.com/Sanjar0126/wiki_change_stream/config"
-	"github.com/Sanjar0126/wiki_change_stream/discord"
 	"github.com/Sanjar0126/wiki_change_stream/event"
 	"github.com/Sanjar0126/wiki_change_stream/models"
-	"github.com/Sanjar0126/wiki_change_stream/pkg/helper"
+	"github.com/Sanjar0126/wiki_change_stream/pipeline"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/metrics"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/tracing"
 	"github.com/Sanjar0126/wiki_change_stream/storage"
 	"github.com/Sanjar0126/wiki_change_stream/storage/db"
+	"github.com/Sanjar0126/wiki_change_stream/storage/mongo"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
 )
 
-func processEvents[T any](ctx context.Context, storage storage.StorageI,
-	eventChan <-chan T, processor func(storage.StorageI, T), wg *sync.WaitGroup) {
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(cfg *config.Config, args []string) error
+}
+
+var commands = []command{
+	{"serve", "[-components ingest,bot,api]", "run the chosen components in one process", runServe},
+	{"ingest", "", "consume the event stream and store changes", runIngest},
+	{"bot", "", "run the Discord bot", runBot},
+	{"api", "", "run the HTTP API", runAPI},
+	{"replay", "<file>", "store events recorded from the stream or as NDJSON", runReplay},
+	{"export", "[flags]", "dump stored changes as NDJSON, CSV or Parquet", runExport},
+	{"import", "[flags] <file>...", "bulk load NDJSON or recorded stream archives", runImport},
+	{"stats", "[-lang en] [-date yyyy-mm-dd]", "print stored change counts", runStats},
+	{"migrate", "", "create storage indexes", runMigrate},
+	{"dlq", "list|retry|purge", "inspect, re-decode or drop rejected events", runDLQ},
+	{"config", "check", "validate the configuration and print the effective values", runConfig},
+}
+
+var log = logger.For("main")
+
+// configPath is set by the global -config flag, empty falls back to
+// CONFIG_FILE or config.yaml.
+var configPath string
+
+// processEvents handles every message until eventChan is closed. Once ctx is
+// cancelled the messages still queued are dropped and counted instead, which
+// bounds how long draining takes.
+func processEvents[T any](ctx context.Context, storage storage.StorageI, eventChan <-chan event.Message[T],
+	processor func(context.Context, storage.StorageI, T), wg *sync.WaitGroup) {
 	defer wg.Done()
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Printf("Processor : Context cancelled, stopping processor")
-			return
-		case event, ok := <-eventChan:
-			if !ok {
-				log.Printf("Processor : Channel closed, stopping processor")
-				return
-			}
-
-			processor(storage, event)
+	var processed, dropped int
+
+	for msg := range eventChan {
+		if ctx.Err() != nil {
+			dropped++
+
+			msg.Done()
+
+			continue
 		}
+
+		msgCtx, cancel := context.WithCancel(msg.Ctx)
+		stop := context.AfterFunc(ctx, cancel)
+
+		processor(msgCtx, storage, msg.Event)
+
+		stop()
+		cancel()
+		msg.Done()
+
+		processed++
 	}
+
+	if dropped > 0 {
+		log.Warn("processor stopped, dropped queued events", "processed", processed, "dropped", dropped)
+		return
+	}
+
+	log.Debug("channel closed, stopping processor", "processed", processed)
 }
 
-func pushToDB(storage storage.StorageI, e models.WikiRecentChanges) {
-	e.ServerPrefix = helper.GetPrefixFromServerName(e.ServerName)
-	storage.WikiChanges().Create(context.Background(), e)
+// saveChange stores a change, one already stored is not an error.
+func saveChange(ctx context.Context, storage storage.StorageI, e models.WikiRecentChanges) error {
+	_, err := storage.WikiChanges().Create(ctx, e)
+	if errors.Is(err, repo.ErrDuplicate) {
+		log.Debug("wiki change already stored", "wiki", e.ServerName, "meta.id", e.Meta.ID)
+		return nil
+	}
+
+	return err
 }
 
-func main() {
-	var wg sync.WaitGroup
+func pushToDB(ctx context.Context, storage storage.StorageI, e models.WikiRecentChanges) {
+	if err := saveChange(ctx, storage, e); err != nil {
+		log.Error("error while saving wiki change", "wiki", e.ServerName, "meta.id", e.Meta.ID, "error", err)
+	}
+}
 
-	cfg := config.Load()
+// enrichAndPush prepares a change the way the ingest pipeline does before
+// storing it, for commands storing changes outside of it.
+func enrichAndPush(ctx context.Context, storage storage.StorageI, e models.WikiRecentChanges) {
+	pipeline.Enrich(&e)
+	pushToDB(ctx, storage, e)
+}
 
-	dbConn := db.NewConn(&cfg)
-	defer func() {
-		err := dbConn.MongoConn.Client().Disconnect(context.Background())
-		if err != nil {
-			panic(err)
-		}
-	}()
+func deadLetter(ctx context.Context, storage storage.StorageI, data []byte, reason error) {
+	_, err := storage.DeadLetter().Create(ctx, models.DeadLetter{
+		Data:      string(data),
+		Error:     reason.Error(),
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		log.Error("error while saving dead letter", "reason", reason, "error", err)
+	}
+}
 
-	storageDB := storage.New(dbConn.MongoConn)
+// openStorage connects to MongoDB and creates any missing index, since every
+// command's queries rely on them.
+func openStorage(ctx context.Context, cfg *config.Config) (storage.StorageI, func(), error) {
+	dbConn := db.NewConn(cfg)
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	disconnect := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Storage.Timeouts.Connect)
+		defer cancel()
 
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
+		if err := dbConn.MongoConn.Client().Disconnect(ctx); err != nil {
+			log.Error("error disconnecting from mongodb", "error", err)
+		}
+	}
 
-	eventChan := make(chan models.WikiRecentChanges)
+	storageDB := storage.New(dbConn.MongoConn, mongo.Timeouts{
+		Read:  cfg.Storage.Timeouts.Read,
+		Write: cfg.Storage.Timeouts.Write,
+		Count: cfg.Storage.Timeouts.Count,
+	})
 
-	eventConfig := event.ConsumerConfig{
-		URL:            config.EventStreamURL,
-		ReconnectDelay: time.Second * 5,
-		GetLatestTimestamp: func() string {
-			return storageDB.WikiChanges().GetLatest()
-		},
-		MaxRetries: 0,
+	if err := storageDB.Migrate(ctx); err != nil {
+		disconnect()
+		return nil, nil, err
 	}
 
-	wg.Add(2)
+	return storageDB, disconnect, nil
+}
 
-	go processEvents(ctx, storageDB, eventChan, pushToDB, &wg)
-	go event.ConsumeEvents(ctx, eventConfig, eventChan, &wg)
+func setupLogger(cfg *config.Config) error {
+	return logger.Setup(logger.Options{
+		Level:      cfg.Log.Level,
+		Format:     cfg.LogFormat(),
+		Components: cfg.Log.Components,
+	})
+}
 
-	discordHander := discord.NewHandler(&discord.HandlerOptions{
-		Config: &cfg,
-		DB:     storageDB,
+func setupTracing(cfg *config.Config) (func(context.Context) error, error) {
+	return tracing.Setup(context.Background(), tracing.Options{
+		Enabled:     cfg.Tracing.Enabled,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
 	})
+}
 
-	discord := discord.NewDiscord(&cfg, discordHander)
+func setupMetrics(cfg *config.Config) (func(context.Context) error, error) {
+	return metrics.Setup(context.Background(), metrics.Options{
+		Enabled:     cfg.Metrics.Enabled,
+		Endpoint:    cfg.Metrics.Endpoint,
+		Insecure:    cfg.Metrics.Insecure,
+		ServiceName: cfg.Metrics.ServiceName,
+		Interval:    cfg.Metrics.Interval,
+	})
+}
 
-	wg.Add(1)
+// signalContext is cancelled on SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
 
-	go func() {
-		defer wg.Done()
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-config file] <command> [arguments]\n\nCommands:\n", os.Args[0])
 
-		if err := discord.Open(); err != nil {
-			log.Printf("Error opening connection: %v", err)
-			cancel()
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.description)
+	}
+
+	w.Flush()
+}
+
+func main() {
+	flags := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	flags.StringVar(&configPath, "config", "", "config file, CONFIG_FILE or config.yaml when empty")
+	flags.Usage = usage
 
-			return
+	if err := flags.Parse(os.Args[1:]); err != nil {
+		os.Exit(2)
+	}
+
+	name := "serve"
+	args := flags.Args()
+
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" || name == "-h" || name == "--help" {
+		usage()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
 		}
 
-		<-ctx.Done()
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if err := setupLogger(&cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		shutdownTracing, err := setupTracing(&cfg)
+		if err != nil {
+			log.Error("error setting up tracing", "error", err)
+			os.Exit(1)
+		}
+
+		shutdownMetrics, err := setupMetrics(&cfg)
+		if err != nil {
+			log.Error("error setting up metrics", "error", err)
+			os.Exit(1)
+		}
+
+		err = cmd.run(&cfg, args)
+
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Warn("error flushing traces", "error", err)
+		}
 
-		if err := discord.Close(); err != nil {
-			log.Printf("Error closing Discord connection: %v", err)
+		if err := shutdownMetrics(context.Background()); err != nil {
+			log.Warn("error flushing metrics", "error", err)
 		}
-	}()
 
-	sig := <-sigChan
-	log.Printf("Received signal: %v", sig)
-	log.Println("Starting shutdown...")
-	cancel()
+		if err != nil {
+			log.Error("command failed", "command", name, "error", err)
+			os.Exit(1)
+		}
+
+		return
+	}
 
-	//wait for all goroutines to finish
-	wg.Wait()
-	log.Println("Shutdown complete")
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
 }
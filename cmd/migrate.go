@@ -0,0 +1,20 @@
+package main
+
+import (
+	"github.com/Sanjar0126/wiki_change_stream/config"
+)
+
+func runMigrate(cfg *config.Config, _ []string) error {
+	ctx, stop := signalContext()
+	defer stop()
+
+	_, disconnect, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	log.Info("migration complete")
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/Sanjar0126/wiki_change_stream/event"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/metrics"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+)
+
+// workerBuffer is how many events may wait for a busy worker before the
+// others wait for it as well.
+const workerBuffer = 64
+
+var (
+	meter = metrics.Meter("processor")
+
+	processorEvents, _ = meter.Int64Counter("processor.events",
+		metric.WithDescription("Events handled by a processor worker"))
+	processorDuration, _ = meter.Float64Histogram("processor.duration", metric.WithUnit("s"),
+		metric.WithDescription("Time a processor worker spent on one event"))
+	processorDepth, _ = meter.Int64ObservableGauge("processor.queue.depth",
+		metric.WithDescription("Events waiting for a processor worker"))
+)
+
+// partitioned returns a drop-in for processEvents running workers copies of
+// it in parallel. Events go to the worker picked by the hash of their key,
+// so events sharing a key are processed in the order they were read.
+func partitioned[T any](workers int, key func(T) string) func(context.Context, storage.StorageI,
+	<-chan event.Message[T], func(context.Context, storage.StorageI, T), *sync.WaitGroup) {
+	return func(ctx context.Context, storage storage.StorageI, eventChan <-chan event.Message[T],
+		processor func(context.Context, storage.StorageI, T), wg *sync.WaitGroup) {
+		defer wg.Done()
+
+		var workerWG sync.WaitGroup
+
+		channels := make([]chan event.Message[T], workers)
+
+		for i := range channels {
+			channels[i] = make(chan event.Message[T], workerBuffer)
+
+			workerWG.Add(1)
+
+			go processEvents(ctx, storage, channels[i], instrumented(i, processor), &workerWG)
+		}
+
+		registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+			for i, ch := range channels {
+				o.ObserveInt64(processorDepth, int64(len(ch)), metric.WithAttributes(attribute.Int("worker", i)))
+			}
+
+			return nil
+		}, processorDepth)
+		if err != nil {
+			log.Warn("error registering processor metrics", "error", err)
+		}
+
+		log.Info("started processor workers", "workers", workers)
+
+		for msg := range eventChan {
+			channels[partition(key(msg.Event), workers)] <- msg
+		}
+
+		for _, ch := range channels {
+			close(ch)
+		}
+
+		workerWG.Wait()
+
+		if registration != nil {
+			if err := registration.Unregister(); err != nil {
+				log.Warn("error unregistering processor metrics", "error", err)
+			}
+		}
+	}
+}
+
+func instrumented[T any](worker int, processor func(context.Context, storage.StorageI, T),
+) func(context.Context, storage.StorageI, T) {
+	attrs := metric.WithAttributes(attribute.Int("worker", worker))
+
+	return func(ctx context.Context, storage storage.StorageI, e T) {
+		start := time.Now()
+
+		processor(ctx, storage, e)
+
+		processorEvents.Add(ctx, 1, attrs)
+		processorDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+	}
+}
+
+func partition(key string, workers int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(workers))
+}
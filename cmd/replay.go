@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/event"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/schema"
+)
+
+func runReplay(cfg *config.Config, args []string) error {
+	var wg sync.WaitGroup
+
+	if len(args) != 1 {
+		return errors.New("usage: replay <file>")
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	storageDB, disconnect, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	schemas := schema.NewRegistry()
+	eventChan := make(chan event.Message[models.WikiRecentChanges])
+
+	eventConfig := event.ConsumerConfig[models.WikiRecentChanges]{
+		Decode: schemas.Decode,
+		OnReject: func(ctx context.Context, data []byte, err error) {
+			deadLetter(ctx, storageDB, data, err)
+		},
+	}
+
+	wg.Add(1)
+
+	go processEvents(ctx, storageDB, eventChan, enrichAndPush, &wg)
+
+	err = event.ReplayFile(ctx, eventConfig, args[0], eventChan)
+
+	wg.Wait()
+
+	return err
+}
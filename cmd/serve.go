@@ -0,0 +1,762 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Sanjar0126/wiki_change_stream/alert"
+	"github.com/Sanjar0126/wiki_change_stream/analytics"
+	"github.com/Sanjar0126/wiki_change_stream/api"
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/discord"
+	"github.com/Sanjar0126/wiki_change_stream/event"
+	"github.com/Sanjar0126/wiki_change_stream/filter"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pipeline"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/tracing"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/wal"
+	"github.com/Sanjar0126/wiki_change_stream/schema"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+const tailInterval = 5 * time.Second
+
+var tracer = tracing.Tracer("ingest")
+
+type components struct {
+	ingest bool
+	bot    bool
+	api    bool
+}
+
+func parseComponents(value string) (components, error) {
+	var c components
+
+	for _, name := range strings.Split(value, ",") {
+		switch strings.TrimSpace(name) {
+		case "ingest":
+			c.ingest = true
+		case "bot":
+			c.bot = true
+		case "api":
+			c.api = true
+		default:
+			return c, fmt.Errorf("unknown component %q", name)
+		}
+	}
+
+	return c, nil
+}
+
+func runServe(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	list := flags.String("components", "ingest,bot,api", "comma separated components to run")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	c, err := parseComponents(*list)
+	if err != nil {
+		return err
+	}
+
+	return serve(cfg, c)
+}
+
+func runIngest(cfg *config.Config, _ []string) error {
+	return serve(cfg, components{ingest: true})
+}
+
+func runBot(cfg *config.Config, _ []string) error {
+	return serve(cfg, components{bot: true})
+}
+
+func runAPI(cfg *config.Config, _ []string) error {
+	return serve(cfg, components{api: true})
+}
+
+func serve(cfg *config.Config, c components) error {
+	var wg sync.WaitGroup
+
+	if c.bot && (cfg.Bot.Token == "" || cfg.Bot.Token == config.Default().Bot.Token) {
+		return errors.New("bot.token (DISCORD_BOT_TOKEN) is required to run the bot")
+	}
+
+	signalCtx, stop := signalContext()
+	defer stop()
+
+	ctx, cancel := context.WithCancel(signalCtx)
+	defer cancel()
+
+	storageDB, disconnect, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	trending := analytics.NewTrending(trendingConfig(cfg))
+
+	schemas := schema.NewRegistry()
+
+	// the bot and the API keep serving while the events already read are
+	// drained, they are closed afterwards
+	servicesCtx, closeServices := context.WithCancel(context.Background())
+	defer closeServices()
+
+	discordHander := discord.NewHandler(&discord.HandlerOptions{
+		Context:  servicesCtx,
+		Config:   cfg,
+		DB:       storageDB,
+		Trending: trending,
+	})
+
+	// sending notifications only needs the REST client, so the ingest
+	// component can use the session without opening the gateway
+	discordSession := discord.NewDiscord(cfg, discordHander)
+
+	var ingest *ingestPipeline
+
+	reloadIngest := func(config.Config) {}
+
+	if c.ingest {
+		ingest, err = startIngest(ctx, cfg, storageDB, schemas, trending,
+			discord.NewNotifier(cfg, discordSession, storageDB), &wg)
+		if err != nil {
+			return err
+		}
+
+		reloadIngest = ingest.Reload
+	} else {
+		wg.Add(1)
+
+		go tailStorage(ctx, storageDB, trending, cfg.Alerts.Trending.Baseline, &wg)
+	}
+
+	// applied is the config of the last reload, so a restart-only change is
+	// reported once rather than on every later reload
+	applied := *cfg
+
+	watcher := config.NewWatcher(cfg.File)
+	watcher.OnReload = func(next config.Config) {
+		if next.Source != applied.Source || next.Processor != applied.Processor ||
+			!slices.Equal(next.Pipeline.Stages, applied.Pipeline.Stages) || next.Storage != applied.Storage ||
+			next.Bot != applied.Bot || next.API != applied.API {
+			log.Warn("source, processor, pipeline, storage, bot and api changes apply after a restart")
+		}
+
+		applied = next
+
+		if err := setupLogger(&next); err != nil {
+			log.Error("error while applying log settings", "error", err)
+		}
+
+		trending.SetConfig(trendingConfig(&next))
+		reloadIngest(next)
+
+		log.Info("reloaded filters, alert rules and log settings", "file", next.File)
+	}
+
+	wg.Add(2)
+
+	go trending.Run(ctx, &wg)
+	go watcher.Run(ctx, &wg)
+
+	if c.api {
+		// schema counts are kept by the process decoding the events
+		apiSchemas := schemas
+		if !c.ingest {
+			apiSchemas = nil
+		}
+
+		startAPI(servicesCtx, cfg, storageDB, apiSchemas, trending, &wg)
+	}
+
+	if c.bot {
+		wg.Add(2)
+
+		go discord.NewDigests(cfg, discordSession, storageDB).Run(servicesCtx, &wg)
+		go func() {
+			defer wg.Done()
+
+			if err := discordSession.Open(); err != nil {
+				log.Error("error opening Discord connection", "error", err)
+				cancel()
+
+				return
+			}
+
+			<-servicesCtx.Done()
+
+			if err := discordSession.Close(); err != nil {
+				log.Error("error closing Discord connection", "error", err)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+	log.Info("starting shutdown", "timeout", cfg.ShutdownTimeout)
+
+	// the consumer stopped with ctx, what it read is stored before the
+	// bot, the API and finally storage are closed
+	if ingest != nil {
+		ingest.Drain(cfg.ShutdownTimeout)
+	}
+
+	closeServices()
+
+	//wait for all goroutines to finish
+	wg.Wait()
+	log.Info("shutdown complete")
+
+	return nil
+}
+
+// checkpointName identifies the checkpoint of the stream consumer.
+const checkpointName = "ingest"
+
+// checkpointInterval is how often the checkpoint is saved while running, so
+// a crash replays at most this much of the stream.
+const checkpointInterval = 30 * time.Second
+
+const (
+	// storageRetries and storageRetryDelay apply to the storage stage when
+	// its on_error is not set.
+	storageRetries    = 3
+	storageRetryDelay = time.Second
+)
+
+// errStorage marks the failure of the storage stage.
+var errStorage = errors.New("error storing change")
+
+// alertQueueSize is how many alerts, and separately edit war incidents, may
+// wait for slow sinks before new ones are dropped.
+const alertQueueSize = 256
+
+// ingestPipeline is the stream consumer and its processor. The consumer stops
+// with the context given to startIngest, the processor keeps going until the
+// events already read are handled or Drain gives up on them.
+type ingestPipeline struct {
+	storageDB    storage.StorageI
+	notifier     *discord.Notifier
+	ingestFilter atomic.Pointer[filter.Filter]
+	alertSinks   atomic.Pointer[alert.Sinks]
+	alerts       *alert.Dispatcher[alert.Alert]
+	incidents    *alert.Dispatcher[models.EditWarIncident]
+	alertsWG     sync.WaitGroup
+	editWar      *alert.EditWar
+	vandalism    *alert.Vandalism
+	// last holds the last event processed by each worker, held marks the
+	// workers whose checkpoint stays put since a change of theirs was
+	// neither stored nor dead-lettered
+	last         []atomic.Pointer[models.Checkpoint]
+	held         []atomic.Bool
+	partitionKey func(models.WikiRecentChanges) string
+	abort        context.CancelFunc
+	wg           sync.WaitGroup
+
+	// changeLog is nil when the write-ahead log is disabled
+	changeLog  *wal.Log
+	logFull    atomic.Bool
+	stopWriter context.CancelFunc
+	writerWG   sync.WaitGroup
+}
+
+func startIngest(ctx context.Context, cfg *config.Config, storageDB storage.StorageI,
+	schemas *schema.Registry, trending *analytics.Trending, notifier *discord.Notifier,
+	wg *sync.WaitGroup) (*ingestPipeline, error) {
+	var (
+		consumed  = make(chan event.Message[models.WikiRecentChanges])
+		eventChan = make(chan event.Message[models.WikiRecentChanges])
+	)
+
+	queue := event.NewQueue[models.WikiRecentChanges]("ingest", event.QueueConfig{
+		Size:          cfg.Source.Queue.Size,
+		Overflow:      event.Overflow(cfg.Source.Queue.Overflow),
+		SpillDir:      cfg.Source.Queue.SpillDir,
+		SpillMaxBytes: int64(cfg.Source.Queue.SpillMaxMB) << 20,
+	})
+
+	p := &ingestPipeline{
+		storageDB: storageDB,
+		notifier:  notifier,
+		editWar:   alert.NewEditWar(editWarConfig(cfg), storageDB),
+		vandalism: alert.NewVandalism(vandalismConfig(cfg)),
+		last:      make([]atomic.Pointer[models.Checkpoint], cfg.Processor.Workers),
+		held:      make([]atomic.Bool, cfg.Processor.Workers),
+		partitionKey: func(e models.WikiRecentChanges) string {
+			return e.ServerName
+		},
+	}
+
+	if cfg.Processor.PartitionBy == "page" {
+		p.partitionKey = func(e models.WikiRecentChanges) string {
+			return e.ServerName + "|" + e.Title
+		}
+	}
+
+	trending.OnTrending = notifier.Trending
+	p.incidents = alert.NewDispatcher("edit_war", alertQueueSize, notifier.EditWar)
+	p.editWar.OnIncident = p.incidents.Dispatch
+
+	p.alerts = alert.NewDispatcher("alerts", alertQueueSize, func(ctx context.Context, a alert.Alert) {
+		p.alertSinks.Load().Send(ctx, a)
+	})
+	p.vandalism.OnAlert = p.alerts.Dispatch
+
+	p.ingestFilter.Store(filter.New(cfg.Filters))
+	p.alertSinks.Store(newAlertSinks(cfg, notifier))
+
+	stages, err := p.stages(cfg.Pipeline, trending)
+	if err != nil {
+		return nil, err
+	}
+
+	processor := func(ctx context.Context, _ storage.StorageI, e models.WikiRecentChanges) {
+		ctx, span := tracer.Start(ctx, "event.process",
+			trace.WithAttributes(tracing.ChangeAttributes(e.ServerName, e.Meta.ID, e.Type)...))
+		defer span.End()
+
+		_, err := stages.Process(ctx, &e)
+		if ctx.Err() != nil {
+			return
+		}
+
+		worker := partition(p.partitionKey(e), len(p.last))
+
+		if errors.Is(err, errStorage) {
+			if err := p.deadLetterChange(ctx, e, err); err != nil {
+				log.Error("change neither stored nor dead-lettered, holding the checkpoint",
+					"meta.id", e.Meta.ID, "error", err)
+				p.held[worker].Store(true)
+			}
+		}
+
+		if !p.held[worker].Load() {
+			p.last[worker].Store(&models.Checkpoint{Name: checkpointName, Dt: e.Meta.Dt, MetaID: e.Meta.ID})
+		}
+	}
+
+	eventConfig := event.ConsumerConfig[models.WikiRecentChanges]{
+		URL:                cfg.Source.URL,
+		ReconnectDelay:     cfg.Source.ReconnectDelay,
+		GetLatestTimestamp: p.resumeFrom,
+		ResumeOnStart:      cfg.Source.Resume,
+		MaxRetries:         cfg.Source.MaxRetries,
+		Decode:             schemas.Decode,
+		OnReject: func(ctx context.Context, data []byte, err error) {
+			deadLetter(ctx, storageDB, data, err)
+		},
+	}
+
+	if cfg.Storage.WAL.Enabled {
+		changeLog, err := openChangeLog(cfg)
+		if err != nil {
+			return nil, err
+		}
+
+		var writerCtx context.Context
+
+		p.changeLog = changeLog
+		writerCtx, p.stopWriter = context.WithCancel(context.WithoutCancel(ctx))
+
+		p.writerWG.Add(1)
+
+		go writeFromLog(writerCtx, storageDB, changeLog, cfg.Storage.WAL.RetryDelay, &p.writerWG)
+	}
+
+	var processCtx context.Context
+
+	processCtx, p.abort = context.WithCancel(context.WithoutCancel(ctx))
+
+	p.alertsWG.Add(2)
+	p.wg.Add(3)
+
+	go p.alerts.Run(processCtx, &p.alertsWG)
+	go p.incidents.Run(processCtx, &p.alertsWG)
+
+	go partitioned(cfg.Processor.Workers, p.partitionKey)(processCtx, storageDB, eventChan, processor, &p.wg)
+	go queue.Run(processCtx, consumed, eventChan, &p.wg)
+	go event.ConsumeEvents(ctx, eventConfig, consumed, &p.wg)
+
+	wg.Add(2)
+
+	go p.editWar.Run(ctx, wg)
+	go p.saveCheckpoints(ctx, wg)
+
+	return p, nil
+}
+
+// Reload swaps the filters and alert rules in place, the stream connection
+// and the events already read are not touched.
+func (p *ingestPipeline) Reload(next config.Config) {
+	p.ingestFilter.Store(filter.New(next.Filters))
+	p.alertSinks.Store(newAlertSinks(&next, p.notifier))
+	p.editWar.SetConfig(editWarConfig(&next))
+	p.vandalism.SetConfig(vandalismConfig(&next))
+}
+
+// stages builds the configured processing pipeline.
+func (p *ingestPipeline) stages(cfg config.PipelineConfig,
+	trending *analytics.Trending) (*pipeline.Pipeline[models.WikiRecentChanges], error) {
+	type change = models.WikiRecentChanges
+
+	known := map[string]pipeline.Stage[change]{
+		"filter": pipeline.StageFunc[change](func(_ context.Context, e *change) error {
+			if !p.ingestFilter.Load().Allow(*e) {
+				return pipeline.ErrSkip
+			}
+
+			return nil
+		}),
+		"server_prefix": pipeline.ServerPrefix,
+		"length_delta":  pipeline.LengthDelta,
+		"storage": pipeline.StageFunc[change](func(ctx context.Context, e *change) error {
+			if err := p.store(ctx, *e); err != nil {
+				return fmt.Errorf("%w: %w", errStorage, err)
+			}
+
+			return nil
+		}),
+		"trending": pipeline.StageFunc[change](func(_ context.Context, e *change) error {
+			trending.Observe(*e)
+			return nil
+		}),
+		"edit_war": pipeline.StageFunc[change](func(ctx context.Context, e *change) error {
+			p.editWar.Observe(ctx, *e)
+			return nil
+		}),
+		"vandalism": pipeline.StageFunc[change](func(ctx context.Context, e *change) error {
+			p.vandalism.Observe(ctx, *e)
+			return nil
+		}),
+	}
+
+	stages := make([]pipeline.StageConfig[change], 0, len(cfg.Stages))
+
+	for _, stage := range cfg.Stages {
+		impl, ok := known[stage.Name]
+		if !ok {
+			return nil, fmt.Errorf("unknown pipeline stage %q", stage.Name)
+		}
+
+		// a failed insert is retried before the change is dead-lettered
+		if stage.Name == "storage" && stage.OnError == "" {
+			stage.OnError, stage.Retries, stage.RetryDelay = string(pipeline.Retry), storageRetries, storageRetryDelay
+		}
+
+		stages = append(stages, pipeline.StageConfig[change]{
+			Name:       stage.Name,
+			Stage:      impl,
+			OnError:    pipeline.ErrorPolicy(stage.OnError),
+			Retries:    stage.Retries,
+			RetryDelay: stage.RetryDelay,
+		})
+	}
+
+	return pipeline.New(stages...), nil
+}
+
+// store appends the change to the write-ahead log for writeFromLog to store,
+// or stores it right away without a log or while the log is full.
+func (p *ingestPipeline) store(ctx context.Context, e models.WikiRecentChanges) error {
+	if p.changeLog != nil {
+		data, err := json.Marshal(e)
+		if err == nil {
+			err = p.changeLog.Append(data)
+		}
+
+		if err == nil {
+			if p.logFull.CompareAndSwap(true, false) {
+				log.Info("write-ahead log has room again")
+			}
+
+			return nil
+		}
+
+		if !errors.Is(err, wal.ErrFull) {
+			log.Error("error appending change to write-ahead log", "meta.id", e.Meta.ID, "error", err)
+		} else if p.logFull.CompareAndSwap(false, true) {
+			log.Warn("write-ahead log is full, storing changes directly")
+		}
+	}
+
+	return saveChange(ctx, p.storageDB, e)
+}
+
+// deadLetterChange keeps a change the storage stage failed on in the dead
+// letter collection, for dlq retry to store later.
+func (p *ingestPipeline) deadLetterChange(ctx context.Context, e models.WikiRecentChanges, reason error) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	_, err = p.storageDB.DeadLetter().Create(ctx, models.DeadLetter{
+		Data:      string(data),
+		Error:     reason.Error(),
+		CreatedAt: time.Now().UTC(),
+	})
+
+	return err
+}
+
+// Drain waits until the processor has handled the events the stopped
+// consumer already read, drops whatever is left once timeout passes and
+// saves the checkpoint of the last processed event.
+func (p *ingestPipeline) Drain(timeout time.Duration) {
+	deadline, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("drained ingest pipeline")
+	case <-deadline.Done():
+		log.Warn("drain timeout reached, dropping the remaining events", "timeout", timeout)
+		p.abort()
+		<-done
+	}
+
+	// the workers are done, so nothing is dispatched anymore
+	p.alerts.Close()
+	p.incidents.Close()
+
+	alertsDone := make(chan struct{})
+
+	go func() {
+		p.alertsWG.Wait()
+		close(alertsDone)
+	}()
+
+	select {
+	case <-alertsDone:
+	case <-deadline.Done():
+		log.Warn("drain timeout reached, cancelling the alerts still being sent")
+		p.abort()
+		<-alertsDone
+	}
+
+	p.abort()
+
+	if p.changeLog != nil {
+		if err := p.changeLog.WaitEmpty(deadline); err != nil {
+			log.Warn("changes left in the write-ahead log are stored on the next start",
+				"bytes", p.changeLog.Pending())
+		}
+
+		p.stopWriter()
+		p.writerWG.Wait()
+
+		if err := p.changeLog.Close(); err != nil {
+			log.Error("error closing write-ahead log", "error", err)
+		}
+	}
+
+	if last := p.saveCheckpoint(context.Background()); last != nil {
+		log.Info("saved checkpoint", "dt", last.Dt, "meta.id", last.MetaID)
+	}
+}
+
+// saveCheckpoints saves the checkpoint every checkpointInterval until the
+// context is cancelled, Drain saves the final one.
+func (p *ingestPipeline) saveCheckpoints(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(checkpointInterval)
+	defer ticker.Stop()
+
+	var saved string
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if last := p.checkpoint(); last != nil && last.MetaID != saved {
+			if checkpoint := p.saveCheckpoint(ctx); checkpoint != nil {
+				saved = checkpoint.MetaID
+			}
+		}
+	}
+}
+
+// saveCheckpoint stores the current checkpoint and returns it, nil when
+// nothing was processed yet or saving failed.
+func (p *ingestPipeline) saveCheckpoint(ctx context.Context) *models.Checkpoint {
+	last := p.checkpoint()
+	if last == nil {
+		return nil
+	}
+
+	saved := *last
+	saved.UpdatedAt = time.Now().UTC()
+
+	if err := p.storageDB.Checkpoint().Save(ctx, saved); err != nil {
+		log.Error("error while saving checkpoint", "meta.id", saved.MetaID, "error", err)
+		return nil
+	}
+
+	return &saved
+}
+
+// checkpoint returns the oldest of the last events processed by each worker.
+// A worker may have dropped events queued after its last one, resuming from
+// the oldest may process some events twice but never skips one.
+func (p *ingestPipeline) checkpoint() *models.Checkpoint {
+	var oldest *models.Checkpoint
+
+	for i := range p.last {
+		last := p.last[i].Load()
+		if last != nil && (oldest == nil || last.Dt.Before(oldest.Dt)) {
+			oldest = last
+		}
+	}
+
+	return oldest
+}
+
+// resumeFrom picks the checkpoint, the oldest event handled by every worker,
+// so events held by lagging partitions are read again and the ones already
+// stored are skipped as duplicates. A reconnect uses the checkpoint of this
+// run, on start the saved one is read and the newest stored change is only
+// used before any checkpoint was saved.
+func (p *ingestPipeline) resumeFrom(ctx context.Context) (time.Time, error) {
+	if last := p.checkpoint(); last != nil {
+		return last.Dt, nil
+	}
+
+	checkpoint, err := p.storageDB.Checkpoint().Get(ctx, checkpointName)
+	if errors.Is(err, repo.ErrNotFound) {
+		return p.storageDB.WikiChanges().GetLatest(ctx)
+	}
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return checkpoint.Dt, nil
+}
+
+func newAlertSinks(cfg *config.Config, notifier *discord.Notifier) *alert.Sinks {
+	sinks := alert.Sinks{notifier}
+	if cfg.Alerts.WebhookURL != "" {
+		sinks = append(sinks, alert.NewWebhook(cfg.Alerts.WebhookURL))
+	}
+
+	return &sinks
+}
+
+func trendingConfig(cfg *config.Config) analytics.TrendingConfig {
+	return analytics.TrendingConfig{
+		Window:         cfg.Alerts.Trending.Window,
+		Baseline:       cfg.Alerts.Trending.Baseline,
+		MinEdits:       cfg.Alerts.Trending.MinEdits,
+		MinScore:       cfg.Alerts.Trending.MinScore,
+		NotifyInterval: cfg.Alerts.Trending.NotifyInterval,
+		NotifyLimit:    cfg.Alerts.Trending.NotifyLimit,
+	}
+}
+
+func editWarConfig(cfg *config.Config) alert.EditWarConfig {
+	return alert.EditWarConfig{
+		Window:     cfg.Alerts.EditWar.Window,
+		MinReverts: cfg.Alerts.EditWar.MinReverts,
+		MaxUsers:   cfg.Alerts.EditWar.MaxUsers,
+	}
+}
+
+func vandalismConfig(cfg *config.Config) alert.VandalismConfig {
+	return alert.VandalismConfig{
+		Thresholds: cfg.Alerts.Vandalism.Thresholds,
+	}
+}
+
+func startAPI(ctx context.Context, cfg *config.Config, storageDB storage.StorageI,
+	schemas *schema.Registry, trending *analytics.Trending, wg *sync.WaitGroup) {
+	apiServer := api.NewServer(&api.HandlerOptions{
+		Config:   cfg,
+		DB:       storageDB,
+		Trending: trending,
+		Schemas:  schemas,
+	})
+
+	wg.Add(1)
+
+	go func() {
+		defer wg.Done()
+
+		go func() {
+			<-ctx.Done()
+
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+
+			if err := apiServer.Shutdown(shutdownCtx); err != nil {
+				log.Error("error shutting down HTTP API", "error", err)
+			}
+		}()
+
+		log.Info("HTTP API listening", "addr", cfg.API.Addr)
+
+		if err := apiServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("error serving HTTP API", "error", err)
+		}
+	}()
+}
+
+// tailStorage feeds the trending tracker from changes stored by an ingest
+// process running elsewhere.
+func tailStorage(ctx context.Context, storageDB storage.StorageI,
+	trending *analytics.Trending, baseline time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	last := primitive.NewObjectIDFromTimestamp(time.Now().Add(-baseline)).Hex()
+
+	ticker := time.NewTicker(tailInterval)
+	defer ticker.Stop()
+
+	for {
+		changes, err := storageDB.WikiChanges().GetAfter(ctx, last, 1000)
+		if err != nil {
+			log.Error("error while tailing wiki changes from db", "error", err)
+		}
+
+		for _, change := range changes {
+			trending.Observe(*change)
+			last = change.BId.Hex()
+		}
+
+		if len(changes) == 1000 && ctx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Debug("context cancelled, stopping tail")
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+func runStats(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	lang := flags.String("lang", "en", "language prefix of the wiki")
+	project := flags.String("project", "", "project family, e.g. wikipedia or wiktionary, empty for all")
+	date := flags.String("date", time.Now().UTC().Format("2006-01-02"), "day to count, yyyy-mm-dd")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+
+	storageDB, disconnect, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer disconnect()
+
+	count, err := storageDB.WikiChanges().GetCountDate(ctx, *date,
+		models.WikiChangesFilter{Lang: *lang, Project: *project})
+	if err != nil {
+		return err
+	}
+
+	_, deadLetters, err := storageDB.DeadLetter().GetAll(ctx, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Changes for %s %s lang: %d\n", *date, *lang, count)
+	fmt.Printf("Dead letters: %d\n", deadLetters)
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/wal"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+	"github.com/Sanjar0126/wiki_change_stream/storage/mongo"
+)
+
+const (
+	walBatchSize = 500
+	// walMaxAttempts is how often MongoDB may reject a batch before its
+	// changes are stored one by one to find the ones it rejects.
+	walMaxAttempts = 5
+)
+
+func openChangeLog(cfg *config.Config) (*wal.Log, error) {
+	changeLog, err := wal.Open(wal.Options{
+		Dir:          cfg.Storage.WAL.Dir,
+		SegmentBytes: int64(cfg.Storage.WAL.SegmentMB) << 20,
+		MaxBytes:     int64(cfg.Storage.WAL.MaxMB) << 20,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if pending := changeLog.Pending(); pending > 0 {
+		log.Info("storing changes left in the write-ahead log", "dir", cfg.Storage.WAL.Dir, "bytes", pending)
+	}
+
+	return changeLog, nil
+}
+
+// writeFromLog stores the changes appended to the write-ahead log in order
+// and acknowledges them once written. A batch failing to be stored is
+// retried while MongoDB is unreachable, until ctx is cancelled in which case
+// it stays in the log for the next start. A batch MongoDB keeps rejecting is
+// stored change by change after walMaxAttempts, the changes it rejects are
+// dead-lettered so they do not hold up the log.
+func writeFromLog(ctx context.Context, storageDB storage.StorageI, changeLog *wal.Log,
+	retryDelay time.Duration, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		records, next, err := changeLog.Read(ctx, walBatchSize)
+		if errors.Is(err, context.Canceled) {
+			log.Debug("context cancelled, stopping write-ahead log writer")
+			return
+		}
+
+		if err != nil {
+			log.Error("error reading write-ahead log", "error", err)
+
+			if !sleep(ctx, retryDelay) {
+				return
+			}
+
+			continue
+		}
+
+		changes := make([]models.WikiRecentChanges, 0, len(records))
+
+		for _, record := range records {
+			var change models.WikiRecentChanges
+
+			if err := json.Unmarshal(record, &change); err != nil {
+				log.Error("error decoding change from write-ahead log, skipping it", "error", err)
+				continue
+			}
+
+			changes = append(changes, change)
+		}
+
+		for attempt, rejected := 1, 0; ; attempt++ {
+			if rejected >= walMaxAttempts {
+				err = storeEach(ctx, storageDB, changes)
+			} else {
+				_, _, err = storageDB.WikiChanges().CreateMany(ctx, changes)
+			}
+
+			if err == nil {
+				break
+			}
+
+			if !mongo.Unreachable(err) {
+				rejected++
+			}
+
+			log.Warn("error storing changes from write-ahead log, retrying",
+				"changes", len(changes), "attempt", attempt, "delay", retryDelay, "error", err)
+
+			if !sleep(ctx, retryDelay) {
+				return
+			}
+		}
+
+		if err := changeLog.Ack(next); err != nil {
+			log.Error("error acknowledging write-ahead log records", "error", err)
+		}
+	}
+}
+
+// storeEach stores changes one at a time and dead-letters the ones MongoDB
+// rejects. It fails while MongoDB is unreachable, when a rejection cannot be
+// told from an outage.
+func storeEach(ctx context.Context, storageDB storage.StorageI, changes []models.WikiRecentChanges) error {
+	for _, change := range changes {
+		_, _, err := storageDB.WikiChanges().CreateMany(ctx, []models.WikiRecentChanges{change})
+		if err == nil {
+			continue
+		}
+
+		if mongo.Unreachable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		data, marshalErr := json.Marshal(change)
+		if marshalErr != nil {
+			return marshalErr
+		}
+
+		log.Error("change rejected by storage, dead-lettering it", "wiki", change.ServerName,
+			"meta.id", change.Meta.ID, "error", err)
+
+		_, err = storageDB.DeadLetter().Create(ctx, models.DeadLetter{
+			Data:      string(data),
+			Error:     err.Error(),
+			CreatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("error while saving dead letter: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// sleep waits for d and reports false when ctx was cancelled first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
@@ -1,61 +1,571 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
-	"github.com/spf13/cast"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
 )
 
+var log = logger.For("config")
+
+const DefaultFile = "config.yaml"
+
 type Config struct {
-	Environment string
+	// File is the config file the values were read from, empty when only
+	// defaults and environment variables were used.
+	File string `yaml:"-"`
+
+	Environment string `yaml:"environment"`
+	// ShutdownTimeout bounds draining the events already read and closing
+	// the API, events still queued after it are dropped and reported.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Log       LogConfig       `yaml:"log"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Metrics   MetricsConfig   `yaml:"metrics"`
+	Source    SourceConfig    `yaml:"source"`
+	Processor ProcessorConfig `yaml:"processor"`
+	Pipeline  PipelineConfig  `yaml:"pipeline"`
+	Filters   FilterConfig    `yaml:"filters"`
+	Storage   StorageConfig   `yaml:"storage"`
+	Bot       BotConfig       `yaml:"bot"`
+	API       APIConfig       `yaml:"api"`
+	Alerts    AlertsConfig    `yaml:"alerts"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"`
+	// Format is text or json, empty picks json outside the develop
+	// environment.
+	Format string `yaml:"format"`
+	// Components overrides the level per component, e.g. event: debug.
+	Components map[string]string `yaml:"components"`
+}
+
+func (c *Config) LogFormat() string {
+	if c.Log.Format != "" {
+		return c.Log.Format
+	}
+
+	if c.Environment == "develop" {
+		return logger.FormatText
+	}
+
+	return logger.FormatJSON
+}
+
+type TracingConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host:port of the OTLP/HTTP receiver.
+	Endpoint    string  `yaml:"endpoint"`
+	Insecure    bool    `yaml:"insecure"`
+	ServiceName string  `yaml:"service_name"`
+	SampleRatio float64 `yaml:"sample_ratio"`
+}
+
+type MetricsConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// Endpoint is the host:port of the OTLP/HTTP receiver.
+	Endpoint    string        `yaml:"endpoint"`
+	Insecure    bool          `yaml:"insecure"`
+	ServiceName string        `yaml:"service_name"`
+	Interval    time.Duration `yaml:"interval"`
+}
+
+type SourceConfig struct {
+	URL            string        `yaml:"url"`
+	ReconnectDelay time.Duration `yaml:"reconnect_delay"`
+	MaxRetries     int           `yaml:"max_retries"`
+	// Resume continues from the saved checkpoint on startup instead of
+	// from the newest event.
+	Resume bool        `yaml:"resume"`
+	Queue  QueueConfig `yaml:"queue"`
+}
+
+// ProcessorConfig runs Workers processors in parallel. Events are assigned
+// to a worker by the hash of their wiki, or of wiki and title with
+// PartitionBy page, so the events of one wiki or page stay in order.
+type ProcessorConfig struct {
+	Workers     int    `yaml:"workers"`
+	PartitionBy string `yaml:"partition_by"`
+}
+
+// PipelineConfig lists the stages every ingested change runs through, in
+// order.
+type PipelineConfig struct {
+	Stages []StageConfig `yaml:"stages"`
+}
+
+type StageConfig struct {
+	Name string `yaml:"name"`
+	// OnError is continue, skip or retry, empty continues, except for the
+	// storage stage which retries.
+	OnError    string        `yaml:"on_error"`
+	Retries    int           `yaml:"retries"`
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+// DefaultStages filters, enriches and stores a change, then feeds the
+// detectors.
+var DefaultStages = []string{
+	"filter", "server_prefix", "length_delta", "storage", "trending", "edit_war", "vandalism",
+}
+
+// QueueConfig sizes the buffer between the stream reader and the processor.
+type QueueConfig struct {
+	Size int `yaml:"size"`
+	// Overflow decides what happens to new events while Size events are
+	// queued: block, drop-oldest, drop-newest or spill to SpillDir.
+	Overflow string `yaml:"overflow"`
+	// SpillDir holds the spill file, events left in it are replayed on the
+	// next start.
+	SpillDir   string `yaml:"spill_dir"`
+	SpillMaxMB int    `yaml:"spill_max_mb"`
+}
+
+type FilterConfig struct {
+	Wikis        []string `yaml:"wikis"`
+	ExcludeWikis []string `yaml:"exclude_wikis"`
+	Types        []string `yaml:"types"`
+	Namespaces   []int    `yaml:"namespaces"`
+	ExcludeBots  bool     `yaml:"exclude_bots"`
+}
+
+type StorageConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Database string `yaml:"database"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+
+	Timeouts StorageTimeouts `yaml:"timeouts"`
+	WAL      WALConfig       `yaml:"wal"`
+}
+
+// WALConfig sets up the write-ahead log keeping changes on disk until they
+// are stored, so ingestion rides out storage outages.
+type WALConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Dir       string `yaml:"dir"`
+	SegmentMB int    `yaml:"segment_mb"`
+	// MaxMB caps the log, changes arriving while it is full are written to
+	// storage right away.
+	MaxMB      int           `yaml:"max_mb"`
+	RetryDelay time.Duration `yaml:"retry_delay"`
+}
+
+// StorageTimeouts bound single storage operations, Count applies to
+// counting queries such as !stats which scan many documents.
+type StorageTimeouts struct {
+	Connect time.Duration `yaml:"connect"`
+	Read    time.Duration `yaml:"read"`
+	Write   time.Duration `yaml:"write"`
+	Count   time.Duration `yaml:"count"`
+}
 
-	MongoDBHost     string
-	MongoDBPassword string
-	MongoDBDatabase string
-	MongoDBUser     string
-	MongoDBPort     int
+type BotConfig struct {
+	AppID         string `yaml:"app_id"`
+	PublicKey     string `yaml:"public_key"`
+	Token         string `yaml:"token"`
+	Permission    string `yaml:"permission"`
+	CommandPrefix string `yaml:"command_prefix"`
+	// CommandTimeout bounds the handling of a single command.
+	CommandTimeout time.Duration `yaml:"command_timeout"`
+	// MessageContent reads commands typed in server channels, it needs the
+	// privileged message content intent. Direct messages work without it.
+	MessageContent bool `yaml:"message_content"`
+	// Welcome lets guilds send new members a welcome message, it needs the
+	// privileged server members intent.
+	Welcome       bool `yaml:"welcome"`
+	InfoColor     int  `yaml:"info_color"`
+	TrendingColor int  `yaml:"trending_color"`
+	AlertColor    int  `yaml:"alert_color"`
+}
+
+type APIConfig struct {
+	Addr string `yaml:"addr"`
+}
+
+type AlertsConfig struct {
+	WebhookURL string          `yaml:"webhook_url"`
+	Trending   TrendingConfig  `yaml:"trending"`
+	EditWar    EditWarConfig   `yaml:"edit_war"`
+	Vandalism  VandalismConfig `yaml:"vandalism"`
+}
+
+type TrendingConfig struct {
+	Window         time.Duration `yaml:"window"`
+	Baseline       time.Duration `yaml:"baseline"`
+	MinEdits       int           `yaml:"min_edits"`
+	MinScore       float64       `yaml:"min_score"`
+	NotifyInterval time.Duration `yaml:"notify_interval"`
+	// NotifyLimit is how many of the top pages of a wiki are announced.
+	NotifyLimit int `yaml:"notify_limit"`
+}
 
-	DiscordAppID     string
-	DiscordPublicKey string
-	DiscordBotToken  string
+type EditWarConfig struct {
+	Window     time.Duration `yaml:"window"`
+	MinReverts int           `yaml:"min_reverts"`
+	MaxUsers   int           `yaml:"max_users"`
 }
 
-func Load() Config {
+type VandalismConfig struct {
+	Thresholds map[string]int `yaml:"thresholds"`
+}
+
+func Default() Config {
+	return Config{
+		Environment:     "develop",
+		ShutdownTimeout: 30 * time.Second,
+		Log: LogConfig{
+			Level: "info",
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			ServiceName: "wiki_change_stream",
+			SampleRatio: 1,
+		},
+		Metrics: MetricsConfig{
+			Endpoint:    "localhost:4318",
+			Insecure:    true,
+			ServiceName: "wiki_change_stream",
+			Interval:    15 * time.Second,
+		},
+		Source: SourceConfig{
+			URL:            "https://stream.wikimedia.org/v2/stream/recentchange",
+			ReconnectDelay: 5 * time.Second,
+			Resume:         true,
+			Queue: QueueConfig{
+				Size:       1000,
+				Overflow:   "block",
+				SpillDir:   "data/spill",
+				SpillMaxMB: 512,
+			},
+		},
+		Processor: ProcessorConfig{
+			Workers:     4,
+			PartitionBy: "wiki",
+		},
+		Pipeline: PipelineConfig{
+			Stages: stages(DefaultStages),
+		},
+		Storage: StorageConfig{
+			Host:     "localhost",
+			Port:     27017,
+			Database: "wiki",
+			User:     "mongo",
+			Password: "mongo",
+			Timeouts: StorageTimeouts{
+				Connect: 10 * time.Second,
+				Read:    5 * time.Second,
+				Write:   5 * time.Second,
+				Count:   30 * time.Second,
+			},
+			WAL: WALConfig{
+				Dir:        "data/wal",
+				SegmentMB:  64,
+				MaxMB:      1024,
+				RetryDelay: 5 * time.Second,
+			},
+		},
+		Bot: BotConfig{
+			AppID:          "YOUR_APP_ID",
+			PublicKey:      "YOUR_PUBLIC_KEY",
+			Token:          "YOUR_BOT_TOKEN",
+			Permission:     "277025777664",
+			CommandPrefix:  "!",
+			CommandTimeout: 30 * time.Second,
+			InfoColor:      0x00ff00,
+			TrendingColor:  0xff9900,
+			AlertColor:     0xff0000,
+		},
+		API: APIConfig{
+			Addr: ":8080",
+		},
+		Alerts: AlertsConfig{
+			Trending: TrendingConfig{
+				Window:         15 * time.Minute,
+				Baseline:       3 * time.Hour,
+				MinEdits:       5,
+				MinScore:       3,
+				NotifyInterval: time.Minute,
+				NotifyLimit:    5,
+			},
+			EditWar: EditWarConfig{
+				Window:     30 * time.Minute,
+				MinReverts: 3,
+				MaxUsers:   3,
+			},
+			Vandalism: VandalismConfig{
+				Thresholds: map[string]int{"default": 2000},
+			},
+		},
+	}
+}
+
+// Load builds the configuration from defaults, the config file and then
+// environment variables (also read from .env), and validates the result.
+// path may be empty, then CONFIG_FILE or config.yaml is used if present.
+func Load(path string) (Config, error) {
 	dir, err := filepath.Abs(filepath.Dir("."))
 	if err != nil {
-		log.Println("failed to retrieve absolute path for .env")
-		panic(err)
+		return Config{}, fmt.Errorf("failed to retrieve absolute path for .env: %w", err)
 	}
 
 	if err := godotenv.Load(filepath.Join(dir, ".env")); err != nil {
-		log.Print("No .env file found")
+		log.Debug("no .env file found")
+	}
+
+	config := Default()
+
+	explicit := path != ""
+	if !explicit {
+		path, explicit = os.LookupEnv("CONFIG_FILE")
+	}
+
+	if !explicit {
+		path = DefaultFile
+	}
+
+	if err := config.readFile(path, explicit); err != nil {
+		return config, err
+	}
+
+	if err := config.applyEnv(); err != nil {
+		return config, err
+	}
+
+	return config, config.Validate()
+}
+
+func (c *Config) readFile(path string, required bool) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	c.File = path
+
+	return nil
+}
+
+// applyEnv overrides the settings given in the environment, values that do
+// not parse are reported by variable name.
+func (c *Config) applyEnv() error {
+	v := &validator{}
+
+	v.setString(&c.Environment, "ENVIRONMENT")
+	v.setDuration(&c.ShutdownTimeout, "SHUTDOWN_TIMEOUT")
+
+	v.setString(&c.Log.Level, "LOG_LEVEL")
+	v.setString(&c.Log.Format, "LOG_FORMAT")
+
+	v.setBool(&c.Tracing.Enabled, "TRACING_ENABLED")
+	v.setString(&c.Tracing.Endpoint, "TRACING_ENDPOINT")
+	v.setBool(&c.Tracing.Insecure, "TRACING_INSECURE")
+	v.setString(&c.Tracing.ServiceName, "TRACING_SERVICE_NAME")
+	v.setFloat(&c.Tracing.SampleRatio, "TRACING_SAMPLE_RATIO")
+
+	v.setBool(&c.Metrics.Enabled, "METRICS_ENABLED")
+	v.setString(&c.Metrics.Endpoint, "METRICS_ENDPOINT")
+	v.setBool(&c.Metrics.Insecure, "METRICS_INSECURE")
+	v.setString(&c.Metrics.ServiceName, "METRICS_SERVICE_NAME")
+	v.setDuration(&c.Metrics.Interval, "METRICS_INTERVAL")
+
+	v.setString(&c.Source.URL, "EVENT_STREAM_URL")
+	v.setDuration(&c.Source.ReconnectDelay, "RECONNECT_DELAY")
+	v.setInt(&c.Source.MaxRetries, "MAX_RETRIES")
+	v.setBool(&c.Source.Resume, "SOURCE_RESUME")
+	v.setInt(&c.Source.Queue.Size, "QUEUE_SIZE")
+	v.setString(&c.Source.Queue.Overflow, "QUEUE_OVERFLOW")
+	v.setString(&c.Source.Queue.SpillDir, "QUEUE_SPILL_DIR")
+	v.setInt(&c.Source.Queue.SpillMaxMB, "QUEUE_SPILL_MAX_MB")
+
+	v.setInt(&c.Processor.Workers, "PROCESSOR_WORKERS")
+	v.setString(&c.Processor.PartitionBy, "PROCESSOR_PARTITION_BY")
+
+	var stageNames []string
+
+	v.setList(&stageNames, "PIPELINE_STAGES")
+
+	if stageNames != nil {
+		c.Pipeline.Stages = stages(stageNames)
+	}
+
+	v.setList(&c.Filters.Wikis, "FILTER_WIKIS")
+	v.setList(&c.Filters.ExcludeWikis, "FILTER_EXCLUDE_WIKIS")
+	v.setList(&c.Filters.Types, "FILTER_TYPES")
+	v.setBool(&c.Filters.ExcludeBots, "FILTER_EXCLUDE_BOTS")
+
+	v.setString(&c.Storage.Host, "MONGO_DB_HOST")
+	v.setInt(&c.Storage.Port, "MONGO_DB_PORT")
+	v.setString(&c.Storage.Database, "MONGO_DB_DATABASE")
+	v.setString(&c.Storage.User, "MONGO_DB_USER")
+	v.setString(&c.Storage.Password, "MONGO_DB_PASSWORD")
+	v.setDuration(&c.Storage.Timeouts.Connect, "STORAGE_CONNECT_TIMEOUT")
+	v.setDuration(&c.Storage.Timeouts.Read, "STORAGE_READ_TIMEOUT")
+	v.setDuration(&c.Storage.Timeouts.Write, "STORAGE_WRITE_TIMEOUT")
+	v.setDuration(&c.Storage.Timeouts.Count, "STORAGE_COUNT_TIMEOUT")
+	v.setBool(&c.Storage.WAL.Enabled, "WAL_ENABLED")
+	v.setString(&c.Storage.WAL.Dir, "WAL_DIR")
+	v.setInt(&c.Storage.WAL.SegmentMB, "WAL_SEGMENT_MB")
+	v.setInt(&c.Storage.WAL.MaxMB, "WAL_MAX_MB")
+	v.setDuration(&c.Storage.WAL.RetryDelay, "WAL_RETRY_DELAY")
+
+	v.setString(&c.Bot.AppID, "DISCORD_APP_ID")
+	v.setString(&c.Bot.PublicKey, "DISCORD_PUBLIC_KEY")
+	v.setString(&c.Bot.Token, "DISCORD_BOT_TOKEN")
+	v.setString(&c.Bot.CommandPrefix, "BOT_COMMAND_PREFIX")
+	v.setDuration(&c.Bot.CommandTimeout, "BOT_COMMAND_TIMEOUT")
+	v.setBool(&c.Bot.MessageContent, "BOT_MESSAGE_CONTENT")
+	v.setBool(&c.Bot.Welcome, "BOT_WELCOME")
+
+	v.setString(&c.API.Addr, "HTTP_ADDR")
+
+	v.setString(&c.Alerts.WebhookURL, "ALERT_WEBHOOK_URL")
+
+	v.setDuration(&c.Alerts.Trending.Window, "TRENDING_WINDOW")
+	v.setDuration(&c.Alerts.Trending.Baseline, "TRENDING_BASELINE")
+	v.setInt(&c.Alerts.Trending.MinEdits, "TRENDING_MIN_EDITS")
+	v.setFloat(&c.Alerts.Trending.MinScore, "TRENDING_MIN_SCORE")
+	v.setDuration(&c.Alerts.Trending.NotifyInterval, "TRENDING_NOTIFY_INTERVAL")
+	v.setInt(&c.Alerts.Trending.NotifyLimit, "TRENDING_NOTIFY_LIMIT")
+
+	v.setDuration(&c.Alerts.EditWar.Window, "EDITWAR_WINDOW")
+	v.setInt(&c.Alerts.EditWar.MinReverts, "EDITWAR_MIN_REVERTS")
+	v.setInt(&c.Alerts.EditWar.MaxUsers, "EDITWAR_MAX_USERS")
+
+	if value, ok := os.LookupEnv("VANDALISM_THRESHOLDS"); ok {
+		thresholds, err := parseIntMap(value)
+		v.check(err == nil, "VANDALISM_THRESHOLDS", "%v", err)
+
+		if err == nil {
+			c.Alerts.Vandalism.Thresholds = thresholds
+		}
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+func (v *validator) setString(field *string, key string) {
+	if value, ok := os.LookupEnv(key); ok {
+		*field = value
+	}
+}
+
+func (v *validator) setInt(field *int, key string) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := strconv.Atoi(strings.TrimSpace(value))
+		v.check(err == nil, key, "must be an integer, got %q", value)
+
+		if err == nil {
+			*field = parsed
+		}
 	}
+}
 
-	config := Config{}
-	config.Environment = cast.ToString(env("ENVIRONMENT", "develop"))
+func (v *validator) setFloat(field *float64, key string) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		v.check(err == nil, key, "must be a number, got %q", value)
 
-	config.MongoDBHost = cast.ToString(env("MONGO_DB_HOST", "localhost"))
-	config.MongoDBHost = cast.ToString(env("MONGO_DB_HOST", "localhost"))
-	config.MongoDBPort = cast.ToInt(env("MONGO_DB_PORT", "27017"))
-	config.MongoDBDatabase = cast.ToString(env("MONGO_DB_DATABASE", "wiki"))
-	config.MongoDBUser = cast.ToString(env("MONGO_DB_USER", "mongo"))
-	config.MongoDBPassword = cast.ToString(env("MONGO_DB_PASSWORD", "mongo"))
+		if err == nil {
+			*field = parsed
+		}
+	}
+}
 
-	config.DiscordAppID = cast.ToString(env("DISCORD_APP_ID", "YOUR_APP_ID"))
-	config.DiscordPublicKey = cast.ToString(env("DISCORD_PUBLIC_KEY", "YOUR_PUBLIC_KEY"))
-	config.DiscordBotToken = cast.ToString(env("DISCORD_BOT_TOKEN", "YOUR_BOT_TOKEN"))
+func (v *validator) setBool(field *bool, key string) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+		v.check(err == nil, key, "must be true or false, got %q", value)
 
-	return config
+		if err == nil {
+			*field = parsed
+		}
+	}
 }
 
-func env(key string, defaultValue interface{}) interface{} {
-	_, exists := os.LookupEnv(key)
-	if exists {
-		return os.Getenv(key)
+func (v *validator) setDuration(field *time.Duration, key string) {
+	if value, ok := os.LookupEnv(key); ok {
+		parsed, err := time.ParseDuration(strings.TrimSpace(value))
+		v.check(err == nil, key, "must be a duration with a unit such as 30s or 5m, got %q", value)
+
+		if err == nil {
+			*field = parsed
+		}
+	}
+}
+
+func (v *validator) setList(field *[]string, key string) {
+	if value, ok := os.LookupEnv(key); ok {
+		*field = nil
+
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*field = append(*field, item)
+			}
+		}
+	}
+}
+
+func stages(names []string) []StageConfig {
+	stages := make([]StageConfig, 0, len(names))
+	for _, name := range names {
+		stages = append(stages, StageConfig{Name: name})
+	}
+
+	return stages
+}
+
+// parseIntMap reads values like "default=2000,en.wikipedia.org=5000".
+func parseIntMap(value string) (map[string]int, error) {
+	result := make(map[string]int)
+
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("must be key=value pairs, got %q", pair)
+		}
+
+		number, err := strconv.Atoi(strings.TrimSpace(val))
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an integer, got %q", strings.TrimSpace(key), val)
+		}
+
+		result[strings.TrimSpace(key)] = number
 	}
 
-	return defaultValue
+	return result, nil
 }
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestApplyEnv(t *testing.T) {
+	tests := []struct {
+		name   string
+		env    map[string]string
+		fields []string
+	}{
+		{"integer", map[string]string{"QUEUE_SIZE": "abc"}, []string{"QUEUE_SIZE"}},
+		{"duration without a unit", map[string]string{"STORAGE_READ_TIMEOUT": "30"},
+			[]string{"STORAGE_READ_TIMEOUT"}},
+		{"bool", map[string]string{"WAL_ENABLED": "yes please"}, []string{"WAL_ENABLED"}},
+		{"float", map[string]string{"TRENDING_MIN_SCORE": "high"}, []string{"TRENDING_MIN_SCORE"}},
+		{"thresholds value", map[string]string{"VANDALISM_THRESHOLDS": "en=x"}, []string{"VANDALISM_THRESHOLDS"}},
+		{"thresholds pair", map[string]string{"VANDALISM_THRESHOLDS": "5000"}, []string{"VANDALISM_THRESHOLDS"}},
+		{"every problem reported", map[string]string{
+			"MONGO_DB_PORT":       "mongo",
+			"EDITWAR_WINDOW":      "half an hour",
+			"TRENDING_MIN_EDITS":  "5",
+			"BOT_MESSAGE_CONTENT": "true",
+		}, []string{"EDITWAR_WINDOW", "MONGO_DB_PORT"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			c := Default()
+
+			if got := problemFields(t, c.applyEnv()); fmt.Sprint(got) != fmt.Sprint(tt.fields) {
+				t.Errorf("applyEnv problems in %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	for key, value := range map[string]string{
+		"QUEUE_SIZE":           " 50 ",
+		"STORAGE_READ_TIMEOUT": "30s",
+		"BOT_MESSAGE_CONTENT":  "true",
+		"TRENDING_MIN_SCORE":   "2.5",
+		"PIPELINE_STAGES":      "filter, ,storage",
+		"VANDALISM_THRESHOLDS": "default=100, en.wikipedia.org=5000,",
+	} {
+		t.Setenv(key, value)
+	}
+
+	c := Default()
+
+	if err := c.applyEnv(); err != nil {
+		t.Fatalf("applyEnv: %v", err)
+	}
+
+	if c.Source.Queue.Size != 50 || c.Storage.Timeouts.Read != 30*time.Second || !c.Bot.MessageContent ||
+		c.Alerts.Trending.MinScore != 2.5 {
+		t.Errorf("overrides not applied: queue size %d, read timeout %v, message content %t, min score %v",
+			c.Source.Queue.Size, c.Storage.Timeouts.Read, c.Bot.MessageContent, c.Alerts.Trending.MinScore)
+	}
+
+	var names []string
+	for _, stage := range c.Pipeline.Stages {
+		names = append(names, stage.Name)
+	}
+
+	if got := fmt.Sprint(names); got != "[filter storage]" {
+		t.Errorf("stages = %s", got)
+	}
+
+	if got := fmt.Sprint(c.Alerts.Vandalism.Thresholds); got != "map[default:100 en.wikipedia.org:5000]" {
+		t.Errorf("thresholds = %s", got)
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		required bool
+		ok       bool
+	}{
+		{"known fields", "processor:\n  workers: 8\n", true, true},
+		{"empty", "", true, true},
+		{"unknown field", "processor:\n  worker: 8\n", true, false},
+		{"wrong type", "processor:\n  workers: many\n", true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			c := Default()
+
+			if err := c.readFile(path, tt.required); (err == nil) != tt.ok {
+				t.Errorf("readFile error = %v, want ok %t", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestReadFileMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	c := Default()
+
+	if err := c.readFile(path, false); err != nil || c.File != "" {
+		t.Errorf("optional missing file: error %v, file %q", err, c.File)
+	}
+
+	if err := c.readFile(path, true); err == nil {
+		t.Error("required missing file was not reported")
+	}
+}
@@ -1,8 +0,0 @@
-package config
-
-const (
-	EventStreamURL   = "https://stream.wikimedia.org/v2/stream/recentchange"
-	BotCommandPrefix = "!"
-	BotInfoColor     = 0x00ff00
-	BotPermission    = "277025777664"
-)
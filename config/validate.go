@@ -0,0 +1,203 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+)
+
+var overflowPolicies = map[string]bool{
+	"block":       true,
+	"drop-oldest": true,
+	"drop-newest": true,
+	"spill":       true,
+}
+
+var stageNames = map[string]bool{
+	"filter":        true,
+	"server_prefix": true,
+	"length_delta":  true,
+	"storage":       true,
+	"trending":      true,
+	"edit_war":      true,
+	"vandalism":     true,
+}
+
+var changeTypes = map[string]bool{
+	"edit":       true,
+	"new":        true,
+	"log":        true,
+	"categorize": true,
+	"external":   true,
+}
+
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, field+": "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.check(c.Environment != "", "environment", "must not be empty")
+	v.check(c.ShutdownTimeout > 0, "shutdown_timeout", "must be a positive duration such as 30s")
+
+	_, err := logger.ParseLevel(c.Log.Level)
+	v.check(err == nil, "log.level", "must be debug, info, warn or error, got %q", c.Log.Level)
+	v.check(c.Log.Format == "" || c.Log.Format == logger.FormatText || c.Log.Format == logger.FormatJSON,
+		"log.format", "must be text or json, got %q", c.Log.Format)
+
+	for component, level := range c.Log.Components {
+		_, err := logger.ParseLevel(level)
+		v.check(err == nil, "log.components."+component, "must be debug, info, warn or error, got %q", level)
+	}
+
+	if c.Tracing.Enabled {
+		_, _, err := net.SplitHostPort(c.Tracing.Endpoint)
+		v.check(err == nil, "tracing.endpoint", "must look like host:port, got %q", c.Tracing.Endpoint)
+		v.check(c.Tracing.ServiceName != "", "tracing.service_name", "must not be empty")
+		v.check(c.Tracing.SampleRatio > 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio",
+			"must be above 0 and at most 1")
+	}
+
+	if c.Metrics.Enabled {
+		_, _, err := net.SplitHostPort(c.Metrics.Endpoint)
+		v.check(err == nil, "metrics.endpoint", "must look like host:port, got %q", c.Metrics.Endpoint)
+		v.check(c.Metrics.ServiceName != "", "metrics.service_name", "must not be empty")
+		v.check(c.Metrics.Interval >= time.Second, "metrics.interval", "must be at least 1s")
+	}
+
+	v.check(isURL(c.Source.URL), "source.url", "must be an http(s) URL, got %q", c.Source.URL)
+	v.check(c.Source.ReconnectDelay > 0, "source.reconnect_delay",
+		"must be a positive duration such as 5s")
+	v.check(c.Source.MaxRetries >= 0, "source.max_retries", "must be 0 (unlimited) or more")
+	v.check(c.Source.Queue.Size > 0, "source.queue.size", "must be at least 1")
+	v.check(overflowPolicies[c.Source.Queue.Overflow], "source.queue.overflow",
+		"must be block, drop-oldest, drop-newest or spill, got %q", c.Source.Queue.Overflow)
+
+	if c.Source.Queue.Overflow == "spill" {
+		v.check(c.Source.Queue.SpillDir != "", "source.queue.spill_dir", "must not be empty")
+		v.check(c.Source.Queue.SpillMaxMB > 0, "source.queue.spill_max_mb", "must be at least 1")
+	}
+
+	v.check(c.Processor.Workers > 0, "processor.workers", "must be at least 1")
+	v.check(c.Processor.PartitionBy == "wiki" || c.Processor.PartitionBy == "page", "processor.partition_by",
+		"must be wiki or page, got %q", c.Processor.PartitionBy)
+
+	seenStages := map[string]bool{}
+
+	for i, stage := range c.Pipeline.Stages {
+		field := fmt.Sprintf("pipeline.stages[%d]", i)
+
+		v.check(stageNames[stage.Name], field+".name", "unknown stage %q", stage.Name)
+		v.check(!seenStages[stage.Name], field+".name", "stage %q is listed twice", stage.Name)
+		v.check(stage.OnError == "" || stage.OnError == "continue" || stage.OnError == "skip" ||
+			stage.OnError == "retry", field+".on_error", "must be continue, skip or retry, got %q", stage.OnError)
+
+		if stage.OnError == "retry" {
+			v.check(stage.Retries > 0, field+".retries", "must be at least 1 to retry")
+			v.check(stage.RetryDelay > 0, field+".retry_delay", "must be a positive duration to retry")
+		}
+
+		seenStages[stage.Name] = true
+	}
+
+	for _, t := range c.Filters.Types {
+		v.check(changeTypes[t], "filters.types", "unknown change type %q", t)
+	}
+
+	for _, wiki := range c.Filters.Wikis {
+		for _, excluded := range c.Filters.ExcludeWikis {
+			v.check(wiki != excluded, "filters.exclude_wikis", "%q is also listed in filters.wikis", wiki)
+		}
+	}
+
+	v.check(c.Storage.Host != "", "storage.host", "must not be empty")
+	v.check(c.Storage.Port > 0 && c.Storage.Port < 65536, "storage.port",
+		"must be between 1 and 65535, got %d", c.Storage.Port)
+	v.check(c.Storage.Database != "", "storage.database", "must not be empty")
+
+	if c.Environment != "develop" {
+		v.check(c.Storage.User != "" && c.Storage.Password != "", "storage.user",
+			"user and password are required outside the develop environment")
+	}
+
+	timeouts := c.Storage.Timeouts
+	v.check(timeouts.Connect > 0, "storage.timeouts.connect", "must be a positive duration")
+	v.check(timeouts.Read > 0, "storage.timeouts.read", "must be a positive duration")
+	v.check(timeouts.Write > 0, "storage.timeouts.write", "must be a positive duration")
+	v.check(timeouts.Count > 0, "storage.timeouts.count", "must be a positive duration")
+
+	if wal := c.Storage.WAL; wal.Enabled {
+		v.check(wal.Dir != "", "storage.wal.dir", "must not be empty")
+		v.check(wal.SegmentMB > 0, "storage.wal.segment_mb", "must be at least 1")
+		v.check(wal.MaxMB >= wal.SegmentMB, "storage.wal.max_mb", "must be at least segment_mb")
+		v.check(wal.RetryDelay > 0, "storage.wal.retry_delay", "must be a positive duration")
+	}
+
+	v.check(c.Bot.CommandPrefix != "" && !strings.ContainsAny(c.Bot.CommandPrefix, " \t\n"),
+		"bot.command_prefix", "must be non-empty and contain no whitespace")
+
+	v.check(c.Bot.CommandTimeout > 0, "bot.command_timeout", "must be a positive duration")
+
+	for field, color := range map[string]int{
+		"bot.info_color":     c.Bot.InfoColor,
+		"bot.trending_color": c.Bot.TrendingColor,
+		"bot.alert_color":    c.Bot.AlertColor,
+	} {
+		v.check(color >= 0 && color <= 0xffffff, field, "must be an RGB value up to 0xffffff")
+	}
+
+	_, _, err = net.SplitHostPort(c.API.Addr)
+	v.check(err == nil, "api.addr", "must look like host:port or :port, got %q", c.API.Addr)
+
+	v.check(c.Alerts.WebhookURL == "" || isURL(c.Alerts.WebhookURL), "alerts.webhook_url",
+		"must be an http(s) URL, got %q", c.Alerts.WebhookURL)
+
+	trending := c.Alerts.Trending
+	v.check(trending.Window >= time.Minute, "alerts.trending.window", "must be at least 1m")
+	v.check(trending.Baseline > trending.Window, "alerts.trending.baseline",
+		"must be longer than alerts.trending.window")
+	v.check(trending.MinEdits > 0, "alerts.trending.min_edits", "must be at least 1")
+	v.check(trending.NotifyInterval > 0, "alerts.trending.notify_interval",
+		"must be a positive duration")
+	v.check(trending.NotifyLimit > 0, "alerts.trending.notify_limit", "must be at least 1")
+
+	editWar := c.Alerts.EditWar
+	v.check(editWar.Window > 0, "alerts.edit_war.window", "must be a positive duration")
+	v.check(editWar.MinReverts >= 2, "alerts.edit_war.min_reverts", "must be at least 2")
+	v.check(editWar.MaxUsers >= 2, "alerts.edit_war.max_users", "must be at least 2")
+
+	for wiki, threshold := range c.Alerts.Vandalism.Thresholds {
+		v.check(threshold >= 0, "alerts.vandalism.thresholds."+wiki, "must not be negative")
+	}
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+
+	return nil
+}
+
+func isURL(value string) bool {
+	u, err := url.Parse(value)
+
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// problemFields returns the sorted fields named by a validation error.
+func problemFields(t *testing.T, err error) []string {
+	t.Helper()
+
+	if err == nil {
+		return nil
+	}
+
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("error %v is not a *ValidationError", err)
+	}
+
+	fields := make([]string, 0, len(invalid.Problems))
+	for _, problem := range invalid.Problems {
+		field, _, _ := strings.Cut(problem, ":")
+		fields = append(fields, field)
+	}
+
+	sort.Strings(fields)
+
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		fields []string
+	}{
+		{"defaults", func(c *Config) {}, nil},
+		{"log level", func(c *Config) { c.Log.Level = "verbose" }, []string{"log.level"}},
+		{"component log level", func(c *Config) { c.Log.Components = map[string]string{"event": "loud"} },
+			[]string{"log.components.event"}},
+		{"tracing endpoint only checked when enabled", func(c *Config) { c.Tracing.Endpoint = "localhost" }, nil},
+		{"tracing", func(c *Config) {
+			c.Tracing.Enabled = true
+			c.Tracing.Endpoint = "localhost"
+			c.Tracing.SampleRatio = 1.5
+		}, []string{"tracing.endpoint", "tracing.sample_ratio"}},
+		{"source url", func(c *Config) { c.Source.URL = "stream.wikimedia.org" }, []string{"source.url"}},
+		{"queue", func(c *Config) {
+			c.Source.Queue.Size = 0
+			c.Source.Queue.Overflow = "drop"
+		}, []string{"source.queue.overflow", "source.queue.size"}},
+		{"spill", func(c *Config) {
+			c.Source.Queue.Overflow = "spill"
+			c.Source.Queue.SpillDir = ""
+			c.Source.Queue.SpillMaxMB = 0
+		}, []string{"source.queue.spill_dir", "source.queue.spill_max_mb"}},
+		{"processor", func(c *Config) {
+			c.Processor.Workers = 0
+			c.Processor.PartitionBy = "user"
+		}, []string{"processor.partition_by", "processor.workers"}},
+		{"unknown and repeated stages", func(c *Config) {
+			c.Pipeline.Stages = []StageConfig{{Name: "storage"}, {Name: "translate"}, {Name: "storage"}}
+		}, []string{"pipeline.stages[1].name", "pipeline.stages[2].name"}},
+		{"stage retries", func(c *Config) {
+			c.Pipeline.Stages = []StageConfig{{Name: "storage", OnError: "retry"}, {Name: "filter", OnError: "panic"}}
+		}, []string{"pipeline.stages[0].retries", "pipeline.stages[0].retry_delay", "pipeline.stages[1].on_error"}},
+		{"filters", func(c *Config) {
+			c.Filters.Types = []string{"edit", "move"}
+			c.Filters.Wikis = []string{"en.wikipedia.org"}
+			c.Filters.ExcludeWikis = []string{"en.wikipedia.org"}
+		}, []string{"filters.exclude_wikis", "filters.types"}},
+		{"storage port", func(c *Config) { c.Storage.Port = 70000 }, []string{"storage.port"}},
+		{"storage credentials outside develop", func(c *Config) {
+			c.Environment = "production"
+			c.Storage.Password = ""
+		}, []string{"storage.user"}},
+		{"storage timeouts", func(c *Config) {
+			c.Storage.Timeouts.Read = 0
+			c.Storage.Timeouts.Count = -time.Second
+		}, []string{"storage.timeouts.count", "storage.timeouts.read"}},
+		{"wal smaller than a segment", func(c *Config) {
+			c.Storage.WAL.Enabled = true
+			c.Storage.WAL.MaxMB = 32
+		}, []string{"storage.wal.max_mb"}},
+		{"command prefix", func(c *Config) { c.Bot.CommandPrefix = "! " }, []string{"bot.command_prefix"}},
+		{"colors", func(c *Config) {
+			c.Bot.InfoColor = -1
+			c.Bot.AlertColor = 0x1000000
+		}, []string{"bot.alert_color", "bot.info_color"}},
+		{"api addr", func(c *Config) { c.API.Addr = "8080" }, []string{"api.addr"}},
+		{"webhook url", func(c *Config) { c.Alerts.WebhookURL = "hooks.example.com/alert" },
+			[]string{"alerts.webhook_url"}},
+		{"trending", func(c *Config) {
+			c.Alerts.Trending.Window = 30 * time.Second
+			c.Alerts.Trending.MinEdits = 0
+			c.Alerts.Trending.NotifyLimit = 0
+		}, []string{"alerts.trending.min_edits", "alerts.trending.notify_limit", "alerts.trending.window"}},
+		{"trending baseline", func(c *Config) { c.Alerts.Trending.Baseline = c.Alerts.Trending.Window },
+			[]string{"alerts.trending.baseline"}},
+		{"edit war", func(c *Config) {
+			c.Alerts.EditWar.MinReverts = 1
+			c.Alerts.EditWar.MaxUsers = 1
+		}, []string{"alerts.edit_war.max_users", "alerts.edit_war.min_reverts"}},
+		{"vandalism threshold", func(c *Config) { c.Alerts.Vandalism.Thresholds["en.wikipedia.org"] = -1 },
+			[]string{"alerts.vandalism.thresholds.en.wikipedia.org"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.change(&c)
+
+			if got := problemFields(t, c.Validate()); fmt.Sprint(got) != fmt.Sprint(tt.fields) {
+				t.Errorf("Validate problems in %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
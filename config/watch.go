@@ -0,0 +1,93 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const watchInterval = 5 * time.Second
+
+// Watcher loads the configuration again when the config file changes on disk
+// or the process receives SIGHUP. Only configurations that pass validation
+// are handed to OnReload, a broken edit keeps the running values.
+type Watcher struct {
+	path     string
+	modTime  time.Time
+	size     int64
+	OnReload func(Config)
+}
+
+func NewWatcher(path string) *Watcher {
+	w := &Watcher{
+		path: path,
+	}
+
+	w.modTime, w.size = w.stat()
+
+	return w
+}
+
+func (w *Watcher) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debug("context cancelled, stopping watcher")
+			return
+		case <-hangup:
+			log.Info("SIGHUP received, reloading")
+			w.reload()
+		case <-ticker.C:
+			if w.path == "" {
+				continue
+			}
+
+			modTime, size := w.stat()
+			if modTime.Equal(w.modTime) && size == w.size {
+				continue
+			}
+
+			log.Info("config file changed, reloading", "file", w.path)
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	w.modTime, w.size = w.stat()
+
+	cfg, err := Load(w.path)
+	if err != nil {
+		log.Error("keeping the running configuration", "error", err)
+		return
+	}
+
+	if w.OnReload != nil {
+		w.OnReload(cfg)
+	}
+}
+
+func (w *Watcher) stat() (time.Time, int64) {
+	if w.path == "" {
+		return time.Time{}, 0
+	}
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+
+	return info.ModTime(), info.Size()
+}
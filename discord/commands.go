@@ -0,0 +1,468 @@
+package discord
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/Sanjar0126/wiki_change_stream/analytics"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+// maxEmbeds is the most embeds Discord accepts in one message.
+const maxEmbeds = 10
+
+var subscriptionTopics = []string{repo.TopicTrending, repo.TopicEditWar, repo.TopicVandalism}
+
+func (h *Handler) commands() []*Command {
+	languagesArg := Arg{
+		Name:     "languages",
+		Help:     "language codes, each optionally followed by a project or all, or server names such as fr.wiktionary.org",
+		Required: true,
+		Variadic: true,
+	}
+
+	return []*Command{
+		{
+			Name:    "ping",
+			Summary: "Checks that the bot is up",
+			Run: func(c *CommandContext) error {
+				return c.Reply(fmt.Sprintf("Pong! User ID: %s", c.Message.Author.ID))
+			},
+		},
+		{
+			Name:     "help",
+			Summary:  "Lists the commands or explains one",
+			Args:     []Arg{{Name: "command", Help: "command to explain"}},
+			Examples: []string{"help", "help trending"},
+			Run:      h.help,
+		},
+		{
+			Name:     "setLang",
+			Aliases:  []string{"lang"},
+			Summary:  "Sets the languages you follow, the project defaults to wikipedia",
+			Args:     []Arg{languagesArg},
+			Examples: []string{"setLang en", "setLang en fr wiktionary", "setLang commons.wikimedia.org"},
+			LoadUser: true,
+			Run:      h.setLanguages,
+		},
+		{
+			Name:     "addLang",
+			Summary:  "Adds languages to the ones you follow",
+			Args:     []Arg{languagesArg},
+			Examples: []string{"addLang de", "addLang es wikivoyage"},
+			LoadUser: true,
+			Run:      h.setLanguages,
+		},
+		{
+			Name:     "removeLang",
+			Summary:  "Removes languages from the ones you follow",
+			Args:     []Arg{languagesArg},
+			Examples: []string{"removeLang de"},
+			LoadUser: true,
+			Run:      h.setLanguages,
+		},
+		{
+			Name:     "languages",
+			Summary:  "Lists the wikis with the most changes in the last day",
+			Args:     []Arg{{Name: "project", Help: "only list the languages of a project, e.g. wiktionary"}},
+			Examples: []string{"languages", "languages wiktionary"},
+			Cooldown: 5 * time.Second,
+			Run: func(c *CommandContext) error {
+				sites, err := h.knownSites(c.Ctx)
+				if err != nil {
+					return fmt.Errorf("error while getting known wikis from db: %w", err)
+				}
+
+				return c.ReplyEmbed(h.languagesEmbed(sites, strings.ToLower(c.Arg("project")), c.Prefix))
+			},
+		},
+		{
+			Name:    "digest",
+			Summary: "Sends you a summary of the languages you follow by direct message, shows the setting without arguments",
+			Args: []Arg{
+				{Name: "daily|weekly|off", Help: "how often, weekly digests come on Mondays"},
+				{Name: "time", Help: "time of day such as 18:30, 09:00 by default"},
+				{Name: "timezone", Help: "time zone name such as Europe/Berlin, UTC by default"},
+			},
+			Examples: []string{"digest daily", "digest weekly 18:30 Europe/Berlin", "digest off"},
+			LoadUser: true,
+			Run:      h.digest,
+		},
+		{
+			Name:     "recent",
+			Summary:  "Shows the most recent changes of the languages you follow",
+			Args:     []Arg{{Name: "offset", Help: "changes to skip"}, {Name: "limit", Help: "changes to show, up to 10"}},
+			Examples: []string{"recent", "recent 10 5"},
+			Feature:  models.FeatureRecent,
+			LoadUser: true,
+			Cooldown: 3 * time.Second,
+			Run:      h.recent,
+		},
+		{
+			Name:     "stats",
+			Summary:  "Counts the changes of a day for each language you follow",
+			Args:     []Arg{{Name: "yyyy-mm-dd", Help: "day to count, today by default"}},
+			Examples: []string{"stats", "stats 2025-01-31"},
+			Feature:  models.FeatureStats,
+			LoadUser: true,
+			Cooldown: 3 * time.Second,
+			Run:      h.stats,
+		},
+		{
+			Name:    "trending",
+			Summary: "Lists pages getting unusually many edits",
+			Args: []Arg{
+				{Name: "wiki", Help: "language code or server name, your first language by default"},
+				{Name: "window", Help: "time span such as 15m or 1h"},
+			},
+			Examples: []string{"trending", "trending en 15m", "trending en.wiktionary.org 1h"},
+			Feature:  models.FeatureTrending,
+			LoadUser: true,
+			Run:      h.trendingPages,
+		},
+		{
+			Name:    "change",
+			Summary: "Shows one stored change by its object id, meta.id or the wiki's recent changes id",
+			Args: []Arg{
+				{Name: "id|wiki", Help: "object id or meta.id, or the wiki of a recent changes id", Required: true},
+				{Name: "rc id", Help: "recent changes id on the wiki"},
+			},
+			Examples: []string{"change 6650f1c2a4b3c2d1e0f9a8b7", "change en 1234567890"},
+			Feature:  models.FeatureLookup,
+			Run:      h.change,
+		},
+		{
+			Name:    "revision",
+			Summary: "Shows the stored change that created a revision",
+			Args: []Arg{
+				{Name: "wiki", Help: "language code or server name", Required: true},
+				{Name: "revision id", Help: "id of the revision", Required: true},
+			},
+			Examples: []string{"revision en 1234567890"},
+			Feature:  models.FeatureLookup,
+			Run:      h.change,
+		},
+		{
+			Name:    "subscribe",
+			Summary: "Posts newly trending pages, edit wars or large removals of a wiki to this channel",
+			Args: []Arg{
+				{Name: "topic", Help: strings.Join(subscriptionTopics, ", "), Required: true},
+				{Name: "wiki", Help: "language code or server name, your first language by default"},
+			},
+			Examples: []string{"subscribe trending", "subscribe vandalism de"},
+			Feature:  models.FeatureSubscriptions,
+			Admin:    true,
+			LoadUser: true,
+			Run:      h.subscribe,
+		},
+		{
+			Name:    "unsubscribe",
+			Summary: "Stops posting a topic to this channel",
+			Args: []Arg{
+				{Name: "topic", Help: strings.Join(subscriptionTopics, ", "), Required: true},
+				{Name: "wiki", Help: "language code or server name, your first language by default"},
+			},
+			Examples: []string{"unsubscribe trending"},
+			Feature:  models.FeatureSubscriptions,
+			Admin:    true,
+			LoadUser: true,
+			Run:      h.subscribe,
+		},
+		{
+			Name:    "guild",
+			Summary: "Shows or changes the server's settings, reset a setting with reset",
+			Args: []Arg{
+				{Name: "setting", Help: "lang, channels, prefix, adminrole, welcome, enable or disable"},
+				{Name: "values", Help: "new value of the setting", Variadic: true},
+			},
+			Examples: []string{
+				"guild", "guild lang de", "guild channels add #wiki", "guild prefix ?",
+				"guild adminrole @moderators", "guild welcome on", "guild disable trending", "guild lang reset",
+			},
+			Admin:      true,
+			GuildOnly:  true,
+			AnyChannel: true,
+			Run:        h.guild,
+		},
+	}
+}
+
+// setLanguages handles !setLang, !addLang and !removeLang.
+func (h *Handler) setLanguages(c *CommandContext) error {
+	languages, err := parseLanguages(c.Args("languages"))
+	if err != nil {
+		return err
+	}
+
+	switch c.Command.Name {
+	case "addLang":
+		if err := h.validateLanguages(c.Ctx, c.Prefix, languages); err != nil {
+			return err
+		}
+
+		followed := slices.Clone(c.User.Wikis())
+
+		for _, language := range languages {
+			if !slices.Contains(followed, language) {
+				followed = append(followed, language)
+			}
+		}
+
+		languages = followed
+	case "removeLang":
+		languages = slices.DeleteFunc(slices.Clone(c.User.Wikis()), func(language models.WikiLanguage) bool {
+			return slices.Contains(languages, language)
+		})
+
+		if len(languages) == 0 {
+			return userErrorf("You need to follow at least one language")
+		}
+	default:
+		if err := h.validateLanguages(c.Ctx, c.Prefix, languages); err != nil {
+			return err
+		}
+	}
+
+	_, err = h.db.DiscordUser().Update(c.Ctx, models.DiscordUser{
+		BId:       c.User.BId,
+		AuthorId:  c.User.AuthorId,
+		Lang:      languages[0].Lang,
+		Project:   languages[0].Project,
+		Languages: languages,
+	})
+	if err != nil {
+		return fmt.Errorf("error while updating user from db: %w", err)
+	}
+
+	return c.Reply(fmt.Sprintf("Languages set to %s", describeLangs(languages)))
+}
+
+func (h *Handler) digest(c *CommandContext) error {
+	var digest *models.Digest
+
+	switch frequency := strings.ToLower(c.Arg("daily|weekly|off")); frequency {
+	case "":
+		if c.User.Digest == nil {
+			return c.Reply(fmt.Sprintf("You get no digest, type %shelp digest to start one", c.Prefix))
+		}
+
+		digest = c.User.Digest
+	case "off":
+		if c.Arg("time") != "" {
+			return errUsage
+		}
+
+		if err := h.db.DiscordUser().SetDigest(c.Ctx, c.User.AuthorId, nil); err != nil {
+			return fmt.Errorf("error while updating digest in db: %w", err)
+		}
+
+		return c.Reply("Your digest is stopped")
+	case models.DigestDaily, models.DigestWeekly:
+		var err error
+
+		digest, err = parseDigest(c.User.Digest, frequency, c.Arg("time"), c.Arg("timezone"))
+		if err != nil {
+			return err
+		}
+
+		// the first digest is the next scheduled one, not the one just passed
+		if digest.SentFor, err = digestSlot(digest, time.Now()); err != nil {
+			return fmt.Errorf("error while scheduling digest: %w", err)
+		}
+
+		if err := h.db.DiscordUser().SetDigest(c.Ctx, c.User.AuthorId, digest); err != nil {
+			return fmt.Errorf("error while updating digest in db: %w", err)
+		}
+	default:
+		return errUsage
+	}
+
+	slot, err := digestSlot(digest, time.Now())
+	if err != nil {
+		return fmt.Errorf("error while scheduling digest: %w", err)
+	}
+
+	return c.Reply(fmt.Sprintf("You get a %s digest of %s at %s %s by direct message, the next one on %s",
+		digest.Frequency, describeLangs(c.User.Wikis()), digest.Time, digest.Timezone,
+		slot.AddDate(0, 0, digestDays(digest)).Format("Mon 2 Jan 15:04")))
+}
+
+func (h *Handler) recent(c *CommandContext) error {
+	var (
+		offset int64
+		limit  int64 = maxEmbeds
+		err    error
+	)
+
+	if c.Arg("offset") != "" {
+		if offset, err = strconv.ParseInt(c.Arg("offset"), 10, 64); err != nil || offset < 0 {
+			return errUsage
+		}
+	}
+
+	if c.Arg("limit") != "" {
+		if limit, err = strconv.ParseInt(c.Arg("limit"), 10, 64); err != nil || limit <= 0 {
+			return errUsage
+		}
+	}
+
+	wikiChanges, _, err := h.db.WikiChanges().GetAll(c.Ctx, offset, min(limit, maxEmbeds),
+		models.WikiChangesFilter{Languages: memberLanguages(c.User, c.Guild), Newest: true})
+	if err != nil {
+		return fmt.Errorf("error while getting wiki changes from db: %w", err)
+	}
+
+	if len(wikiChanges) == 0 {
+		return c.Reply("No changes stored for " + describeLangs(memberLanguages(c.User, c.Guild)))
+	}
+
+	embeds := make([]*discordgo.MessageEmbed, 0, len(wikiChanges))
+
+	for _, wikiChange := range wikiChanges {
+		embeds = append(embeds, h.changeEmbed(wikiChange))
+	}
+
+	return c.ReplyEmbed(embeds...)
+}
+
+func (h *Handler) stats(c *CommandContext) error {
+	date := c.Arg("yyyy-mm-dd")
+	if date == "" {
+		date = time.Now().UTC().Format(time.DateOnly)
+	}
+
+	if _, err := time.Parse(time.DateOnly, date); err != nil {
+		return errUsage
+	}
+
+	languages := memberLanguages(c.User, c.Guild)
+	lines := make([]string, 0, len(languages))
+
+	for _, language := range languages {
+		count, err := h.db.WikiChanges().GetCountDate(c.Ctx, date, models.WikiChangesFilter{
+			Languages: []models.WikiLanguage{language},
+		})
+		if err != nil {
+			return fmt.Errorf("error while getting changes count from db: %w", err)
+		}
+
+		lines = append(lines, fmt.Sprintf("Changes for %s %s: %d", date, describeLang(language), count))
+	}
+
+	return c.Reply(strings.Join(lines, "\n"))
+}
+
+func (h *Handler) trendingPages(c *CommandContext) error {
+	var (
+		window time.Duration
+		err    error
+	)
+
+	wiki := c.Arg("wiki")
+	if wiki == "" {
+		wiki = defaultWiki(memberLanguages(c.User, c.Guild))
+	}
+
+	if c.Arg("window") != "" {
+		window, err = time.ParseDuration(c.Arg("window"))
+		if err != nil {
+			return userErrorf("Window must look like 15m or 1h")
+		}
+	}
+
+	pages, err := h.trending.Top(wiki, window, 10)
+	if err != nil {
+		return userError{msg: err.Error()}
+	}
+
+	return c.ReplyEmbed(h.trendingListEmbed(analytics.NormalizeWiki(wiki), window, pages))
+}
+
+// change handles !change and !revision.
+func (h *Handler) change(c *CommandContext) error {
+	args := []string{c.Arg("id|wiki"), c.Arg("rc id")}
+	if c.Command.Name == "revision" {
+		args = []string{c.Arg("wiki"), c.Arg("revision id")}
+	}
+
+	if args[1] == "" {
+		args = args[:1]
+	}
+
+	wikiChange, err := h.lookupChange(c.Ctx, c.Command.Name, args)
+
+	switch {
+	case errors.Is(err, errUsage):
+		return err
+	case errors.Is(err, repo.ErrNotFound):
+		return userErrorf("Change not found")
+	case err != nil:
+		return fmt.Errorf("error while getting wiki change from db: %w", err)
+	}
+
+	return c.ReplyEmbed(h.changeEmbed(wikiChange))
+}
+
+// subscribe handles !subscribe and !unsubscribe.
+func (h *Handler) subscribe(c *CommandContext) error {
+	topic := strings.ToLower(c.Arg("topic"))
+	if !slices.Contains(subscriptionTopics, topic) {
+		return errUsage
+	}
+
+	wiki := c.Arg("wiki")
+	if wiki == "" {
+		wiki = defaultWiki(memberLanguages(c.User, c.Guild))
+	}
+
+	wiki = analytics.NormalizeWiki(wiki)
+
+	var err error
+
+	if c.Command.Name == "subscribe" {
+		_, err = h.db.DiscordSubscription().Create(c.Ctx, models.DiscordSubscription{
+			ChannelID: c.Message.ChannelID,
+			AuthorId:  c.Message.Author.ID,
+			Topic:     topic,
+			Wiki:      wiki,
+		})
+	} else {
+		err = h.db.DiscordSubscription().Delete(c.Ctx, c.Message.ChannelID, topic, wiki)
+	}
+
+	if err != nil {
+		return fmt.Errorf("error while updating %s subscription for %s in db: %w", topic, wiki, err)
+	}
+
+	if c.Command.Name == "unsubscribe" {
+		return c.Reply(fmt.Sprintf("Unsubscribed from %s for %s", topic, wiki))
+	}
+
+	return c.Reply(fmt.Sprintf("Subscribed to %s for %s", topic, wiki))
+}
+
+func (h *Handler) guild(c *CommandContext) error {
+	if c.Arg("setting") == "" {
+		return c.ReplyEmbed(h.guildEmbed(c.Guild))
+	}
+
+	updated, err := h.updateGuild(c.Ctx, c.Prefix, *c.Guild, c.Arg("setting"), c.Args("values"))
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.DiscordGuild().Save(c.Ctx, *updated); err != nil {
+		return fmt.Errorf("error while saving guild settings: %w", err)
+	}
+
+	h.cacheGuild(updated)
+
+	return c.ReplyEmbed(h.guildEmbed(updated))
+}
@@ -0,0 +1,375 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	// digest time zones must load in images without a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/wikisite"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+)
+
+const (
+	// digestTick is how often the scheduler looks for digests that are due.
+	digestTick            = time.Minute
+	defaultDigestTime     = "09:00"
+	defaultDigestTimezone = "UTC"
+	digestPages           = 5
+	// maxFieldLength is the most characters Discord accepts in a field value.
+	maxFieldLength = 1024
+)
+
+// notableLogTypes are the log events a digest counts among notable events.
+var notableLogTypes = []string{"delete", "block", "protect", "merge"}
+
+var digestCount, _ = meter.Int64Counter("discord.digests",
+	metric.WithDescription("Digests handled, by frequency and result"))
+
+// Digests sends users the daily or weekly summary of the languages they
+// follow by direct message.
+type Digests struct {
+	config  *config.Config
+	session *discordgo.Session
+	db      storage.StorageI
+}
+
+func NewDigests(cfg *config.Config, session *discordgo.Session, db storage.StorageI) *Digests {
+	return &Digests{
+		config:  cfg,
+		session: session,
+		db:      db,
+	}
+}
+
+// Run sends the digests that are due until the context is cancelled. A
+// digest whose time passed while the bot was down is sent late, only the
+// latest one of each user.
+func (d *Digests) Run(ctx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	ticker := time.NewTicker(digestTick)
+	defer ticker.Stop()
+
+	for {
+		d.sendDue(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			log.Debug("context cancelled, stopping digests")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// digestPeriod is the summary of a set of languages over a period, shared
+// by the users with the same ones.
+type digestPeriod struct {
+	summary   *models.WikiDigest
+	incidents []*models.EditWarIncident
+}
+
+func (d *Digests) sendDue(ctx context.Context, now time.Time) {
+	users, err := d.db.DiscordUser().GetDigestSubscribers(ctx)
+	if err != nil {
+		log.Error("error while getting digest subscribers from db", "error", err)
+		return
+	}
+
+	periods := make(map[string]digestPeriod)
+
+	for _, user := range users {
+		if ctx.Err() != nil {
+			return
+		}
+
+		slot, err := digestSlot(user.Digest, now)
+		if err != nil {
+			log.Error("invalid digest settings", "discord.user", user.AuthorId, "error", err)
+			continue
+		}
+
+		if !user.Digest.SentFor.Before(slot) {
+			continue
+		}
+
+		result := "ok"
+
+		if err := d.send(ctx, user, slot, periods); err != nil {
+			result = "error"
+
+			log.Error("error while sending digest", "discord.user", user.AuthorId, "error", err)
+		}
+
+		digestCount.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("frequency", user.Digest.Frequency), attribute.String("result", result)))
+	}
+}
+
+func (d *Digests) send(ctx context.Context, user *models.DiscordUser, slot time.Time,
+	periods map[string]digestPeriod) error {
+	ctx, span := tracer.Start(ctx, "discord.digest", trace.WithAttributes(
+		attribute.String("discord.user", user.AuthorId), attribute.String("frequency", user.Digest.Frequency)))
+	defer span.End()
+
+	from := digestStart(user.Digest, slot)
+	languages := user.Wikis()
+
+	key := fmt.Sprintf("%s|%d|%d", describeLangs(languages), from.Unix(), slot.Unix())
+
+	period, ok := periods[key]
+	if !ok {
+		summary, err := d.db.WikiChanges().GetDigest(ctx, models.WikiChangesFilter{
+			Languages: languages,
+			From:      from,
+			To:        slot,
+		}, digestPages)
+		if err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("error while summarizing changes: %w", err)
+		}
+
+		incidents, err := d.db.EditWar().GetDetected(ctx, from, slot)
+		if err != nil {
+			span.RecordError(err)
+			return fmt.Errorf("error while getting edit wars from db: %w", err)
+		}
+
+		period = digestPeriod{summary: summary, incidents: followedIncidents(incidents, languages)}
+		periods[key] = period
+	}
+
+	err := d.deliver(ctx, user.AuthorId, d.digestEmbed(user.Digest, languages, from, slot, period))
+
+	// users who do not accept direct messages miss this digest rather than
+	// being retried every tick
+	var restErr *discordgo.RESTError
+	if errors.As(err, &restErr) && restErr.Response != nil && restErr.Response.StatusCode == http.StatusForbidden {
+		log.Warn("user does not accept direct messages, skipping digest", "discord.user", user.AuthorId)
+	} else if err != nil {
+		span.RecordError(err)
+		return err
+	}
+
+	return d.db.DiscordUser().MarkDigestSent(ctx, user.AuthorId, slot)
+}
+
+func (d *Digests) deliver(ctx context.Context, userID string, embed *discordgo.MessageEmbed) error {
+	dmChannel, err := d.session.UserChannelCreate(userID, discordgo.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+
+	_, err = d.session.ChannelMessageSendEmbed(dmChannel.ID, embed, discordgo.WithContext(ctx))
+
+	return err
+}
+
+func (d *Digests) digestEmbed(digest *models.Digest, languages []models.WikiLanguage,
+	from, to time.Time, period digestPeriod) *discordgo.MessageEmbed {
+	summary := period.summary
+	layout := "Mon 2 Jan 15:04"
+
+	embed := &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Your %s digest", digest.Frequency),
+		Description: fmt.Sprintf("%s from %s to %s %s", describeLangs(languages),
+			from.Format(layout), to.Format(layout), digest.Timezone),
+		Color: d.config.Bot.InfoColor,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Type %sdigest off to stop it", d.config.Bot.CommandPrefix),
+		},
+	}
+
+	if summary.Changes == 0 && len(period.incidents) == 0 {
+		embed.Description += "\nNo changes were stored in this period."
+		return embed
+	}
+
+	embed.Fields = []*discordgo.MessageEmbedField{
+		{Name: "Changes", Value: fmt.Sprintf("%d", summary.Changes), Inline: true},
+		{Name: "Edits", Value: fmt.Sprintf("%d", summary.Edits), Inline: true},
+		{Name: "New pages", Value: fmt.Sprintf("%d", summary.NewPages), Inline: true},
+		{Name: "Log events", Value: fmt.Sprintf("%d", summary.Logs), Inline: true},
+		{Name: "Editors", Value: fmt.Sprintf("%d", summary.Users), Inline: true},
+		{Name: "By bots", Value: fmt.Sprintf("%d", summary.Bots), Inline: true},
+	}
+
+	pages := make([]string, 0, len(summary.TopPages))
+	for i, page := range summary.TopPages {
+		pages = append(pages, fmt.Sprintf("%d. [%s](%s) on %s - %d edits",
+			i+1, page.Title, page.TitleURL, page.ServerName, page.Edits))
+	}
+
+	created := make([]string, 0, len(summary.Created))
+	for _, page := range summary.Created {
+		created = append(created, fmt.Sprintf("[%s](%s) on %s", page.Title, page.TitleURL, page.ServerName))
+	}
+
+	var notable []string
+
+	for _, incident := range period.incidents {
+		notable = append(notable, fmt.Sprintf("Edit war on %s: [%s](%s), %d reverts",
+			incident.Wiki, incident.Title, incident.TitleURL, incident.Reverts))
+	}
+
+	for _, logCount := range summary.LogActions {
+		if slices.Contains(notableLogTypes, logCount.LogType) {
+			notable = append(notable, fmt.Sprintf("%d %s/%s log events",
+				logCount.Count, logCount.LogType, logCount.LogAction))
+		}
+	}
+
+	for _, field := range []struct {
+		name  string
+		lines []string
+	}{
+		{"Most edited pages", pages},
+		{"New articles", created},
+		{"Notable events", notable},
+	} {
+		if len(field.lines) > 0 {
+			embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+				Name:  field.name,
+				Value: joinLines(field.lines, maxFieldLength),
+			})
+		}
+	}
+
+	return embed
+}
+
+// joinLines joins as many lines as fit in limit characters.
+func joinLines(lines []string, limit int) string {
+	var joined strings.Builder
+
+	for _, line := range lines {
+		if joined.Len() > 0 {
+			line = "\n" + line
+		}
+
+		if joined.Len()+len(line) > limit {
+			break
+		}
+
+		joined.WriteString(line)
+	}
+
+	return joined.String()
+}
+
+// truncate cuts value to at most limit characters, marking the cut with an
+// ellipsis.
+func truncate(value string, limit int) string {
+	runes := []rune(value)
+	if len(runes) <= limit {
+		return value
+	}
+
+	return string(runes[:limit-1]) + "…"
+}
+
+// followedIncidents keeps the edit wars of the wikis the languages cover.
+func followedIncidents(incidents []*models.EditWarIncident,
+	languages []models.WikiLanguage) []*models.EditWarIncident {
+	return slices.DeleteFunc(incidents, func(incident *models.EditWarIncident) bool {
+		site := wikisite.Parse(incident.Wiki, "")
+
+		return !slices.ContainsFunc(languages, func(language models.WikiLanguage) bool {
+			return matchesSite(language, models.WikiSite{Prefix: site.Prefix(), Project: site.Project})
+		})
+	})
+}
+
+// parseDigest reads the arguments of !digest daily|weekly [time] [timezone]
+// on top of the current settings, the time zone may also come first.
+func parseDigest(current *models.Digest, frequency, clock, timezone string) (*models.Digest, error) {
+	digest := &models.Digest{
+		Frequency: strings.ToLower(frequency),
+		Time:      defaultDigestTime,
+		Timezone:  defaultDigestTimezone,
+	}
+
+	if current != nil {
+		digest.Time, digest.Timezone = current.Time, current.Timezone
+	}
+
+	if clock != "" {
+		parsed, err := time.Parse("15:04", clock)
+
+		switch {
+		case err == nil:
+			digest.Time = parsed.Format("15:04")
+		case timezone == "" && !strings.Contains(clock, ":"):
+			timezone = clock
+		default:
+			return nil, userErrorf("Time must look like 09:00 or 18:30")
+		}
+	}
+
+	if timezone != "" {
+		if _, err := time.LoadLocation(timezone); err != nil {
+			return nil, userErrorf("Unknown time zone %s, use a name such as Europe/Berlin or UTC", timezone)
+		}
+
+		digest.Timezone = timezone
+	}
+
+	return digest, nil
+}
+
+// digestSlot returns the latest time the digest was scheduled for, at or
+// before now.
+func digestSlot(digest *models.Digest, now time.Time) (time.Time, error) {
+	location, err := time.LoadLocation(digest.Timezone)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	clock, err := time.Parse("15:04", digest.Time)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	local := now.In(location)
+
+	slot := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, location)
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -1)
+	}
+
+	if digest.Frequency == models.DigestWeekly {
+		// back to the Monday of the week
+		slot = slot.AddDate(0, 0, -((int(slot.Weekday()) + 6) % 7))
+	}
+
+	return slot, nil
+}
+
+// digestStart returns the start of the period a digest scheduled at slot
+// covers.
+func digestStart(digest *models.Digest, slot time.Time) time.Time {
+	return slot.AddDate(0, 0, -digestDays(digest))
+}
+
+// digestDays is the number of days between two digests.
+func digestDays(digest *models.Digest) int {
+	if digest.Frequency == models.DigestWeekly {
+		return 7
+	}
+
+	return 1
+}
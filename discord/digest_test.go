@@ -0,0 +1,142 @@
+package discord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+func TestDigestSlot(t *testing.T) {
+	var (
+		daily  = models.DigestDaily
+		weekly = models.DigestWeekly
+	)
+
+	tests := []struct {
+		name      string
+		frequency string
+		clock     string
+		timezone  string
+		now       string
+		want      string
+	}{
+		{"at the slot", daily, "09:00", "UTC", "2024-05-01T09:00:00Z", "2024-05-01T09:00:00Z"},
+		{"a minute before the slot", daily, "09:00", "UTC", "2024-05-01T08:59:00Z", "2024-04-30T09:00:00Z"},
+		{"a minute after the slot", daily, "09:00", "UTC", "2024-05-01T09:01:00Z", "2024-05-01T09:00:00Z"},
+		{"ahead of UTC before the slot", daily, "09:00", "Asia/Tokyo", "2024-05-01T23:30:00Z",
+			"2024-05-01T00:00:00Z"},
+		{"ahead of UTC at the slot", daily, "09:00", "Asia/Tokyo", "2024-05-02T00:00:00Z",
+			"2024-05-02T00:00:00Z"},
+		{"behind UTC on the next UTC day", daily, "18:30", "America/Los_Angeles", "2024-05-01T01:00:00Z",
+			"2024-04-30T01:30:00Z"},
+		{"daylight saving starts", daily, "09:00", "Europe/Berlin", "2024-03-31T07:00:00Z",
+			"2024-03-31T07:00:00Z"},
+		{"before daylight saving starts", daily, "09:00", "Europe/Berlin", "2024-03-31T06:59:00Z",
+			"2024-03-30T08:00:00Z"},
+		{"weekly mid week", weekly, "09:00", "UTC", "2024-05-01T10:00:00Z", "2024-04-29T09:00:00Z"},
+		{"weekly at the slot", weekly, "09:00", "UTC", "2024-04-29T09:00:00Z", "2024-04-29T09:00:00Z"},
+		{"weekly a minute before the slot", weekly, "09:00", "UTC", "2024-04-29T08:59:00Z",
+			"2024-04-22T09:00:00Z"},
+		{"weekly on sunday", weekly, "09:00", "UTC", "2024-05-05T23:00:00Z", "2024-04-29T09:00:00Z"},
+		{"weekly monday already begun locally", weekly, "09:00", "Asia/Tokyo", "2024-05-05T23:30:00Z",
+			"2024-04-29T00:00:00Z"},
+		{"weekly at the slot ahead of UTC", weekly, "09:00", "Asia/Tokyo", "2024-05-06T00:00:00Z",
+			"2024-05-06T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now, err := time.Parse(time.RFC3339, tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			digest := &models.Digest{Frequency: tt.frequency, Time: tt.clock, Timezone: tt.timezone}
+
+			slot, err := digestSlot(digest, now)
+			if err != nil {
+				t.Fatalf("digestSlot: %v", err)
+			}
+
+			if got := slot.UTC().Format(time.RFC3339); got != tt.want {
+				t.Errorf("digestSlot at %s = %s, want %s", tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDigestSlotInvalid(t *testing.T) {
+	tests := []models.Digest{
+		{Frequency: models.DigestDaily, Time: "09:00", Timezone: "Mars/Olympus"},
+		{Frequency: models.DigestDaily, Time: "9am", Timezone: "UTC"},
+	}
+
+	for _, digest := range tests {
+		t.Run(digest.Time+" "+digest.Timezone, func(t *testing.T) {
+			if _, err := digestSlot(&digest, time.Now()); err == nil {
+				t.Errorf("digestSlot(%+v) did not fail", digest)
+			}
+		})
+	}
+}
+
+func TestDigestStart(t *testing.T) {
+	slot := time.Date(2024, 5, 6, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		frequency string
+		want      time.Time
+	}{
+		{models.DigestDaily, time.Date(2024, 5, 5, 9, 0, 0, 0, time.UTC)},
+		{models.DigestWeekly, time.Date(2024, 4, 29, 9, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.frequency, func(t *testing.T) {
+			if got := digestStart(&models.Digest{Frequency: tt.frequency}, slot); !got.Equal(tt.want) {
+				t.Errorf("digestStart = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDigest(t *testing.T) {
+	current := &models.Digest{Frequency: models.DigestDaily, Time: "18:00", Timezone: "Europe/Berlin"}
+
+	tests := []struct {
+		name      string
+		current   *models.Digest
+		frequency string
+		clock     string
+		timezone  string
+		want      models.Digest
+		ok        bool
+	}{
+		{"defaults", nil, "Daily", "", "", models.Digest{Frequency: "daily", Time: "09:00", Timezone: "UTC"}, true},
+		{"keeps the current time", current, "weekly", "", "",
+			models.Digest{Frequency: "weekly", Time: "18:00", Timezone: "Europe/Berlin"}, true},
+		{"time", current, "daily", "7:05", "",
+			models.Digest{Frequency: "daily", Time: "07:05", Timezone: "Europe/Berlin"}, true},
+		{"time and time zone", nil, "daily", "18:30", "Asia/Tokyo",
+			models.Digest{Frequency: "daily", Time: "18:30", Timezone: "Asia/Tokyo"}, true},
+		{"time zone first", current, "daily", "Asia/Tokyo", "",
+			models.Digest{Frequency: "daily", Time: "18:00", Timezone: "Asia/Tokyo"}, true},
+		{"hour out of range", nil, "daily", "25:00", "", models.Digest{}, false},
+		{"time zone twice", nil, "daily", "Asia/Tokyo", "UTC", models.Digest{}, false},
+		{"unknown time zone", nil, "daily", "09:00", "Mars/Olympus", models.Digest{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digest, err := parseDigest(tt.current, tt.frequency, tt.clock, tt.timezone)
+			if (err == nil) != tt.ok {
+				t.Fatalf("parseDigest error = %v, want ok %t", err, tt.ok)
+			}
+
+			if tt.ok && *digest != tt.want {
+				t.Errorf("parseDigest = %+v, want %+v", *digest, tt.want)
+			}
+		})
+	}
+}
@@ -1,16 +1,44 @@
 package discord
 
 import (
-	"log"
+	"net/http"
+	"os"
 
 	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/tracing"
 	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+var (
+	log    = logger.For("discord")
+	tracer = tracing.Tracer("discord")
 )
 
 func NewDiscord(cfg *config.Config, handler *Handler) *discordgo.Session {
-	dg, err := discordgo.New("Bot " + cfg.DiscordBotToken)
+	dg, err := discordgo.New("Bot " + cfg.Bot.Token)
 	if err != nil {
-		log.Fatal("Error creating Discord session: ", err)
+		log.Error("error creating Discord session", "error", err)
+		os.Exit(1)
+	}
+
+	// REST calls made with discordgo.WithContext join the caller's trace
+	dg.Client.Transport = otelhttp.NewTransport(http.DefaultTransport)
+
+	// commands sent in server channels need the privileged message content
+	// intent and welcoming new members the server members one. Each is only
+	// requested when enabled since the gateway refuses privileged intents the
+	// app was not granted.
+	dg.Identify.Intents = discordgo.IntentsAllWithoutPrivileged
+
+	if cfg.Bot.MessageContent {
+		dg.Identify.Intents |= discordgo.IntentMessageContent
+	}
+
+	if cfg.Bot.Welcome {
+		dg.Identify.Intents |= discordgo.IntentGuildMembers
+		dg.AddHandler(handler.MemberJoin)
 	}
 
 	dg.AddHandler(handler.MessageHandle)
@@ -0,0 +1,260 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+// guildTTL is how long guild settings are cached, every message in a guild
+// needs them to find the command prefix.
+const guildTTL = time.Minute
+
+type guildCache struct {
+	mu     sync.Mutex
+	guilds map[string]cachedGuild
+}
+
+type cachedGuild struct {
+	guild   *models.DiscordGuild
+	expires time.Time
+}
+
+// guildSettings returns the settings of a guild, the defaults for direct
+// messages and guilds without stored settings.
+func (h *Handler) guildSettings(ctx context.Context, guildID string) (*models.DiscordGuild, error) {
+	if guildID == "" {
+		return &models.DiscordGuild{}, nil
+	}
+
+	h.guilds.mu.Lock()
+	cached, ok := h.guilds.guilds[guildID]
+	h.guilds.mu.Unlock()
+
+	if ok && time.Now().Before(cached.expires) {
+		return cached.guild, nil
+	}
+
+	guild, err := h.db.DiscordGuild().Get(ctx, guildID)
+	if errors.Is(err, repo.ErrNotFound) {
+		guild, err = &models.DiscordGuild{GuildID: guildID}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	h.cacheGuild(guild)
+
+	return guild, nil
+}
+
+func (h *Handler) cacheGuild(guild *models.DiscordGuild) {
+	h.guilds.mu.Lock()
+	defer h.guilds.mu.Unlock()
+
+	h.guilds.guilds[guild.GuildID] = cachedGuild{guild: guild, expires: time.Now().Add(guildTTL)}
+}
+
+// isAdmin reports whether the author of a guild message may change the
+// guild's settings: members allowed to manage the server and those with the
+// admin role.
+func isAdmin(s *discordgo.Session, m *discordgo.MessageCreate, guild *models.DiscordGuild) (bool, error) {
+	if m.Member != nil && guild.AdminRole != "" && slices.Contains(m.Member.Roles, guild.AdminRole) {
+		return true, nil
+	}
+
+	permissions, err := s.State.MessagePermissions(m.Message)
+	if err != nil {
+		//nolint:staticcheck // falls back to the REST API when the state lacks the guild
+		permissions, err = s.UserChannelPermissions(m.Author.ID, m.ChannelID)
+		if err != nil {
+			return false, err
+		}
+	}
+
+	return permissions&(discordgo.PermissionAdministrator|discordgo.PermissionManageServer) != 0, nil
+}
+
+// updateGuild applies a setting of !guild to a copy of the guild's settings
+// and returns it, prefix is the one the command was typed with.
+func (h *Handler) updateGuild(ctx context.Context, prefix string, guild models.DiscordGuild,
+	setting string, values []string) (*models.DiscordGuild, error) {
+	if len(values) == 0 {
+		return nil, errUsage
+	}
+
+	setting = strings.ToLower(setting)
+	reset := len(values) == 1 && strings.EqualFold(values[0], "reset")
+
+	switch setting {
+	case "lang":
+		if reset {
+			guild.Lang, guild.Project = "", ""
+			break
+		}
+
+		languages, err := parseLanguages(values)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := h.validateLanguages(ctx, prefix, languages[:1]); err != nil {
+			return nil, err
+		}
+
+		guild.Lang, guild.Project = languages[0].Lang, languages[0].Project
+	case "channels":
+		action, channels := strings.ToLower(values[0]), mentionIDs(values[1:], "<#")
+
+		switch {
+		case reset:
+			guild.AllowedChannels = nil
+		case action == "add" && len(channels) > 0:
+			guild.AllowedChannels = slices.Clone(guild.AllowedChannels)
+
+			for _, channel := range channels {
+				if !slices.Contains(guild.AllowedChannels, channel) {
+					guild.AllowedChannels = append(guild.AllowedChannels, channel)
+				}
+			}
+		case action == "remove" && len(channels) > 0:
+			guild.AllowedChannels = slices.DeleteFunc(slices.Clone(guild.AllowedChannels), func(channel string) bool {
+				return slices.Contains(channels, channel)
+			})
+		default:
+			return nil, errUsage
+		}
+	case "prefix":
+		guild.CommandPrefix = values[0]
+		if reset {
+			guild.CommandPrefix = ""
+		}
+	case "adminrole":
+		roles := mentionIDs(values[:1], "<@&")
+
+		switch {
+		case reset:
+			guild.AdminRole = ""
+		case len(roles) == 1:
+			guild.AdminRole = roles[0]
+		default:
+			return nil, errUsage
+		}
+	case "welcome":
+		if !h.config.Bot.Welcome && !reset {
+			return nil, userErrorf("Welcome messages are turned off for this bot, its operator has to enable bot.welcome")
+		}
+
+		switch strings.ToLower(values[0]) {
+		case "on":
+			guild.Welcome = true
+		case "off", "reset":
+			guild.Welcome = false
+		default:
+			return nil, errUsage
+		}
+	case "enable", "disable":
+		feature := strings.ToLower(values[0])
+		if !slices.Contains(models.GuildFeatures, feature) {
+			return nil, userErrorf("Unknown feature %s, the features are %s",
+				feature, strings.Join(models.GuildFeatures, ", "))
+		}
+
+		disabled := make(map[string]bool, len(guild.Disabled)+1)
+		for name, off := range guild.Disabled {
+			disabled[name] = off
+		}
+
+		disabled[feature] = setting == "disable"
+		guild.Disabled = disabled
+	default:
+		return nil, errUsage
+	}
+
+	return &guild, nil
+}
+
+// mentionIDs strips channel or role mentions down to the ids.
+func mentionIDs(values []string, prefix string) []string {
+	ids := make([]string, 0, len(values))
+
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+
+		ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(value, prefix), ">"))
+	}
+
+	return ids
+}
+
+func (h *Handler) guildEmbed(guild *models.DiscordGuild) *discordgo.MessageEmbed {
+	language := "not set, members' own"
+	if guild.Lang != "" {
+		language = describeLang(models.WikiLanguage{Lang: guild.Lang, Project: guild.Project})
+	}
+
+	channels := "all"
+	if len(guild.AllowedChannels) > 0 {
+		mentions := make([]string, 0, len(guild.AllowedChannels))
+		for _, channel := range guild.AllowedChannels {
+			mentions = append(mentions, "<#"+channel+">")
+		}
+
+		channels = strings.Join(mentions, " ")
+	}
+
+	adminRole := "none, members allowed to manage the server"
+	if guild.AdminRole != "" {
+		adminRole = "<@&" + guild.AdminRole + ">"
+	}
+
+	welcome := "off"
+	if guild.Welcome {
+		welcome = "on"
+	}
+
+	features := make([]string, 0, len(models.GuildFeatures))
+
+	for _, feature := range models.GuildFeatures {
+		state := "on"
+		if !guild.Enabled(feature) {
+			state = "off"
+		}
+
+		features = append(features, feature+": "+state)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title: "Server settings",
+		Color: h.config.Bot.InfoColor,
+		Fields: []*discordgo.MessageEmbedField{
+			{Name: "Default language", Value: language, Inline: true},
+			{Name: "Command prefix", Value: guild.Prefix(h.config.Bot.CommandPrefix), Inline: true},
+			{Name: "Admin role", Value: adminRole, Inline: true},
+			{Name: "Welcome message", Value: welcome, Inline: true},
+			{Name: "Channels", Value: channels},
+			{Name: "Features", Value: strings.Join(features, ", ")},
+		},
+	}
+}
+
+// memberLanguages returns the languages commands use for a member: the ones
+// they picked, otherwise the guild's default language.
+func memberLanguages(user *models.DiscordUser, guild *models.DiscordGuild) []models.WikiLanguage {
+	if len(user.Languages) == 0 && guild.Lang != "" {
+		return []models.WikiLanguage{{Lang: guild.Lang, Project: guild.Project}}
+	}
+
+	return user.Wikis()
+}
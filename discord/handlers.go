@@ -3,87 +3,104 @@ package discord
 import (
 	"context"
 	"fmt"
-	"log"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Sanjar0126/wiki_change_stream/analytics"
 	"github.com/Sanjar0126/wiki_change_stream/config"
 	"github.com/Sanjar0126/wiki_change_stream/models"
 	"github.com/Sanjar0126/wiki_change_stream/storage"
 	"github.com/bwmarrin/discordgo"
-	"github.com/spf13/cast"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Handler struct {
-	config *config.Config
-	db     storage.StorageI
+	ctx      context.Context
+	config   *config.Config
+	db       storage.StorageI
+	trending *analytics.Trending
+	sites    *siteCache
+	guilds   *guildCache
+	router   *Router
 }
 
 type HandlerOptions struct {
-	Config *config.Config
-	DB     storage.StorageI
+	// Context is the lifetime of the bot, commands still running are
+	// cancelled with it.
+	Context  context.Context
+	Config   *config.Config
+	DB       storage.StorageI
+	Trending *analytics.Trending
 }
 
 func NewHandler(opts *HandlerOptions) *Handler {
-	return &Handler{
-		config: opts.Config,
-		db:     opts.DB,
+	h := &Handler{
+		ctx:      opts.Context,
+		config:   opts.Config,
+		db:       opts.DB,
+		trending: opts.Trending,
+		sites:    &siteCache{},
+		guilds:   &guildCache{guilds: make(map[string]cachedGuild)},
+		router:   NewRouter(),
 	}
+
+	h.router.Use(instrument, replyErrors, checkGuild, h.router.cooldown, h.loadUser)
+	h.router.Register(h.commands()...)
+
+	return h
 }
 
 func (h *Handler) Ready(s *discordgo.Session, event *discordgo.Ready) {
-	log.Printf("Bot is ready! Logged in as: %v#%v\n", event.User.Username, event.User.Discriminator)
+	log.Info("bot is ready", "discord.user", event.User.ID, "username", event.User.Username)
 }
 
+// MemberJoin sends new members of guilds that turned the welcome message on
+// an introduction to the commands.
 func (h *Handler) MemberJoin(s *discordgo.Session, m *discordgo.GuildMemberAdd) {
-	log.Printf("New member joined: %s#%s", m.User.Username, m.User.Discriminator)
+	if m.User == nil || m.User.Bot {
+		return
+	}
 
-	welcomeEmbed := &discordgo.MessageEmbed{
-		Title:       fmt.Sprintf("Welcome to %s!", m.GuildID),
-		Description: "Thanks for joining! Here's some information to help you get started:",
-		Color:       config.BotInfoColor,
-		Fields: []*discordgo.MessageEmbedField{
-			{
-				Name:   "SetLang command",
-				Value:  "type !setLang <lang code>, e.g. !setLang en (e.g., ru, fr, es, etc.). Default is en",
-				Inline: false,
-			},
-			{
-				Name:   "Recent command",
-				Value:  "type !recent for getting recent wiki changes for the current language, you can enter offset and limit !recent <offset> <limit>",
-				Inline: false,
-			},
-			{
-				Name:   "Daily stats command",
-				Value:  "type !stats [yyyy-mm-dd] to display how many changes occurred on that date for the chosen language",
-				Inline: false,
-			},
-		},
-		Footer: &discordgo.MessageEmbedFooter{
-			Text: "We hope you enjoy your stay!",
-		},
+	memberLog := log.With("discord.user", m.User.ID, "guild", m.GuildID)
+	memberLog.Info("new member joined")
+
+	ctx, cancel := context.WithTimeout(h.ctx, h.config.Bot.CommandTimeout)
+	defer cancel()
+
+	guild, err := h.guildSettings(ctx, m.GuildID)
+	if err != nil {
+		memberLog.Error("error getting guild settings", "error", err)
+		return
+	}
+
+	if !guild.Welcome {
+		return
+	}
+
+	guildName := m.GuildID
+	if discordGuild, err := s.State.Guild(m.GuildID); err == nil {
+		guildName = discordGuild.Name
 	}
 
-	dmChannel, err := s.UserChannelCreate(m.User.ID)
+	dmChannel, err := s.UserChannelCreate(m.User.ID, discordgo.WithContext(ctx))
 	if err != nil {
-		log.Printf("Error creating DM channel: %v", err)
+		memberLog.Error("error creating DM channel", "error", err)
 		return
 	}
 
-	_, err = s.ChannelMessageSendEmbed(dmChannel.ID, welcomeEmbed)
+	_, err = s.ChannelMessageSendEmbed(dmChannel.ID, h.welcomeEmbed(guildName, guild), discordgo.WithContext(ctx))
 	if err != nil {
-		log.Printf("Error sending welcome DM: %v", err)
+		memberLog.Error("error sending welcome DM", "error", err)
 		return
 	}
 
-	log.Printf("Sent welcome DM to %s", m.User.Username)
+	memberLog.Info("sent welcome DM")
 }
 
 func (h *Handler) MessageHandle(s *discordgo.Session, m *discordgo.MessageCreate) {
-	var (
-		commandArg string
-	)
-
 	if m.Author.ID == s.State.User.ID {
 		return
 	}
@@ -92,174 +109,194 @@ func (h *Handler) MessageHandle(s *discordgo.Session, m *discordgo.MessageCreate
 	if err != nil {
 		channel, err = s.Channel(m.ChannelID)
 		if err != nil {
-			log.Printf("Error getting channel: %v", err)
+			log.Error("error getting channel", "discord.user", m.Author.ID,
+				"channel", m.ChannelID, "error", err)
 			return
 		}
 	}
 
-	if channel.Type != discordgo.ChannelTypeDM {
-		return
-	}
-
-	if !strings.HasPrefix(m.Content, config.BotCommandPrefix) {
+	if channel.Type != discordgo.ChannelTypeDM && channel.GuildID == "" {
 		return
 	}
 
-	args := strings.Split(strings.TrimPrefix(m.Content, config.BotCommandPrefix), " ")
-	if len(args) == 0 {
+	guild, err := h.guildSettings(h.ctx, channel.GuildID)
+	if err != nil {
+		log.Error("error getting guild settings", "guild", channel.GuildID, "error", err)
 		return
 	}
 
-	command := strings.ToLower(args[0])
+	prefix := guild.Prefix(h.config.Bot.CommandPrefix)
 
-	if len(args) > 1 {
-		commandArg = args[1]
+	command, words, ok := h.router.Parse(m.Content, prefix)
+	if !ok || (!command.AnyChannel && !guild.AllowsChannel(m.ChannelID)) {
+		return
 	}
 
-	switch command {
-	case "ping":
-		response := fmt.Sprintf("Pong! User ID: %s", m.Author.ID)
-		_, err = s.ChannelMessageSend(m.ChannelID, response)
-	case "setlang":
-		lang := commandArg
+	cmdLog := log.With("discord.user", m.Author.ID, "discord.command", command.Name)
+	cmdLog.Debug("command received")
+
+	ctx, cancel := context.WithTimeout(h.ctx, h.config.Bot.CommandTimeout)
+	defer cancel()
+
+	ctx, span := tracer.Start(ctx, "discord.command "+command.Name, trace.WithAttributes(
+		attribute.String("discord.user", m.Author.ID), attribute.String("discord.command", command.Name)))
+	defer span.End()
+
+	_ = h.router.Run(&CommandContext{
+		Ctx:     ctx,
+		Session: s,
+		Message: m,
+		Command: command,
+		Prefix:  prefix,
+		Guild:   guild,
+		Log:     cmdLog,
+	}, words)
+}
 
-		discordUser, err := h.db.DiscordUser().GetOrCreate(
-			context.Background(), m.Author.ID)
+// lookupChange resolves the arguments of !change and !revision.
+func (h *Handler) lookupChange(ctx context.Context, command string,
+	args []string) (*models.WikiRecentChanges, error) {
+	wikiChanges := h.db.WikiChanges()
+
+	switch {
+	case command == "change" && len(args) == 1 && primitive.IsValidObjectID(args[0]):
+		return wikiChanges.Get(ctx, args[0])
+	case command == "change" && len(args) == 1:
+		return wikiChanges.GetByMetaID(ctx, args[0])
+	case len(args) == 2:
+		id, err := strconv.ParseInt(args[1], 10, 64)
 		if err != nil {
-			log.Println("error while getting user from db", err)
-			return
+			return nil, errUsage
 		}
 
-		_, err = h.db.DiscordUser().Update(context.Background(), models.DiscordUser{
-			BId:      discordUser.BId,
-			AuthorId: discordUser.AuthorId,
-			Lang:     lang,
-		})
-
-		if err != nil {
-			log.Println("error while updating user from db", err)
-			return
+		if command == "revision" {
+			return wikiChanges.GetByRevision(ctx, analytics.NormalizeWiki(args[0]), id)
 		}
 
-		response := fmt.Sprintf("Language set to %s", lang)
-
-		_, err = s.ChannelMessageSend(m.ChannelID, response)
-
-	case "stats":
-		date := commandArg
+		return wikiChanges.GetByRCID(ctx, analytics.NormalizeWiki(args[0]), id)
+	default:
+		return nil, errUsage
+	}
+}
 
-		discordUser, err := h.db.DiscordUser().GetOrCreate(
-			context.Background(), m.Author.ID)
-		if err != nil {
-			log.Println("error while getting user from db", err)
-			return
-		}
+// changeEmbed describes one stored change, the footer carries the ids
+// !change accepts.
+func (h *Handler) changeEmbed(wikiChange *models.WikiRecentChanges) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title: "Wiki recent changes",
+		URL:   wikiChange.DiffURL(),
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "ID",
+				Value:  fmt.Sprintf("%d", wikiChange.ID),
+				Inline: true,
+			},
+			{
+				Name:   "Title",
+				Value:  truncate(wikiChange.Title, maxFieldLength),
+				Inline: true,
+			},
+			{
+				Name:   "Title url",
+				Value:  wikiChange.TitleURL,
+				Inline: true,
+			},
+			{
+				Name:   "Type",
+				Value:  wikiChange.Type,
+				Inline: true,
+			},
+			{
+				Name:   "Comment",
+				Value:  truncate(wikiChange.Comment, maxFieldLength),
+				Inline: true,
+			},
+			{
+				Name:   "User",
+				Value:  wikiChange.User,
+				Inline: true,
+			},
+			{
+				Name:   "Is bot",
+				Value:  fmt.Sprintf("%t", wikiChange.Bot),
+				Inline: true,
+			},
+			{
+				Name:   "Server name",
+				Value:  wikiChange.ServerName,
+				Inline: true,
+			},
+			{
+				Name:   "Wiki type",
+				Value:  wikiChange.Wiki,
+				Inline: true,
+			},
+			{
+				Name:   "Timestamp",
+				Value:  wikiChange.Time().Format("2006-01-02 15:04:05"),
+				Inline: true,
+			},
+		},
+		Color: h.config.Bot.InfoColor,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%s · %s", wikiChange.BId.Hex(), wikiChange.Meta.ID),
+		},
+	}
 
-		count, err := h.db.WikiChanges().GetCountDate(date, discordUser.Lang)
-		if err != nil {
-			log.Println("error while getting changes count from db", err)
-			return
-		}
+	if wikiChange.IsLog() {
+		embed.Fields = append(embed.Fields, logFields(wikiChange)...)
+	}
 
-		response := fmt.Sprintf("Changes for %s %s lang: %d", date, discordUser.Lang, count)
+	return embed
+}
 
-		_, err = s.ChannelMessageSend(m.ChannelID, response)
-	case "recent":
-		var (
-			offset int64 = 0
-			limit  int64 = 10
-		)
+func (h *Handler) trendingListEmbed(wiki string, window time.Duration,
+	pages []analytics.TrendingPage) *discordgo.MessageEmbed {
+	if window == 0 {
+		window = h.trending.DefaultWindow()
+	}
 
-		discordUser, err := h.db.DiscordUser().GetOrCreate(
-			context.Background(), m.Author.ID)
-		if err != nil {
-			log.Println("error while getting user from db", err)
-			return
-		}
+	lines := make([]string, 0, len(pages))
 
-		if len(args) > 1 {
-			offset = cast.ToInt64(args[1])
-		}
+	for i, page := range pages {
+		lines = append(lines, fmt.Sprintf("%d. [%s](%s) - %d edits (expected %.1f)",
+			i+1, page.Title, page.TitleURL, page.Edits, page.Expected))
+	}
 
-		if len(args) > 2 {
-			limit = cast.ToInt64(args[2])
-		}
+	description := strings.Join(lines, "\n")
+	if description == "" {
+		description = "Nothing is trending right now"
+	}
 
-		wikiChanges, _, err := h.db.WikiChanges().GetAll(
-			context.Background(), offset, limit, discordUser.Lang)
-		if err != nil {
-			log.Println("error while getting wiki changes from db", err)
-			return
-		}
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Trending on %s in the last %v", wiki, window),
+		Description: description,
+		Color:       h.config.Bot.TrendingColor,
+	}
+}
 
-		embeds := []*discordgo.MessageEmbed{}
-
-		for _, wikiChange := range wikiChanges {
-			embed := &discordgo.MessageEmbed{
-				Title: "Wiki recent changes",
-				Fields: []*discordgo.MessageEmbedField{
-					{
-						Name:   "ID",
-						Value:  fmt.Sprintf("%d", wikiChange.ID),
-						Inline: true,
-					},
-					{
-						Name:   "Title",
-						Value:  wikiChange.Title,
-						Inline: true,
-					},
-					{
-						Name:   "Title url",
-						Value:  wikiChange.TitleURL,
-						Inline: true,
-					},
-					{
-						Name:   "Type",
-						Value:  wikiChange.Type,
-						Inline: true,
-					},
-					{
-						Name:   "Comment",
-						Value:  wikiChange.Comment,
-						Inline: true,
-					},
-					{
-						Name:   "User",
-						Value:  wikiChange.User,
-						Inline: true,
-					},
-					{
-						Name:   "Is bot",
-						Value:  fmt.Sprintf("%t", wikiChange.Bot),
-						Inline: true,
-					},
-					{
-						Name:   "Server name",
-						Value:  wikiChange.ServerName,
-						Inline: true,
-					},
-					{
-						Name:   "Wiki type",
-						Value:  wikiChange.Wiki,
-						Inline: true,
-					},
-					{
-						Name: "Timestamp",
-						Value: time.Unix(
-							int64(wikiChange.Timestamp), 0).Format("2006-01-02 15:04:05"),
-						Inline: true,
-					},
-				},
-				Color: config.BotInfoColor,
-			}
-
-			embeds = append(embeds, embed)
-		}
+func logFields(wikiChange *models.WikiRecentChanges) []*discordgo.MessageEmbedField {
+	fields := []*discordgo.MessageEmbedField{
+		{
+			Name:   "Log",
+			Value:  fmt.Sprintf("%s/%s (#%d)", wikiChange.LogType, wikiChange.LogAction, wikiChange.LogID),
+			Inline: true,
+		},
+	}
 
-		_, err = s.ChannelMessageSendEmbeds(m.ChannelID, embeds)
+	if wikiChange.LogActionComment != "" {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Log action",
+			Value: truncate(wikiChange.LogActionComment, maxFieldLength),
+		})
 	}
 
-	if err != nil {
-		log.Printf("error while sending message %s, %v", command, err)
+	if !wikiChange.LogParams.IsEmpty() {
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  "Log params",
+			Value: truncate(wikiChange.LogParams.String(), maxFieldLength),
+		})
 	}
+
+	return fields
 }
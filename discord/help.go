@@ -0,0 +1,161 @@
+package discord
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+func (h *Handler) help(c *CommandContext) error {
+	if name := c.Arg("command"); name != "" {
+		command, ok := h.router.Lookup(strings.TrimPrefix(name, c.Prefix))
+		if !ok {
+			return userErrorf("Unknown command %s, type %shelp to list them", name, c.Prefix)
+		}
+
+		return c.ReplyEmbed(h.commandHelpEmbed(command, c.Prefix, c.Guild))
+	}
+
+	return c.ReplyEmbed(h.helpEmbed(c.Prefix, c.Guild))
+}
+
+// helpEmbed lists the commands usable in the guild, or in direct messages
+// for the zero guild.
+func (h *Handler) helpEmbed(prefix string, guild *models.DiscordGuild) *discordgo.MessageEmbed {
+	lines := make([]string, 0, len(h.router.Commands()))
+
+	for _, command := range h.router.Commands() {
+		if !available(command, guild) {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("`%s` %s", command.Usage(prefix), command.Summary))
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       "Commands",
+		Description: strings.Join(lines, "\n"),
+		Color:       h.config.Bot.InfoColor,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Type %shelp <command> for its arguments and examples", prefix),
+		},
+	}
+}
+
+func (h *Handler) commandHelpEmbed(command *Command, prefix string,
+	guild *models.DiscordGuild) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       command.Usage(prefix),
+		Description: command.Summary,
+		Color:       h.config.Bot.InfoColor,
+	}
+
+	if len(command.Args) > 0 {
+		args := make([]string, 0, len(command.Args))
+
+		for _, arg := range command.Args {
+			optional := ""
+			if !arg.Required {
+				optional = ", optional"
+			}
+
+			args = append(args, fmt.Sprintf("`%s`%s: %s", arg.Name, optional, arg.Help))
+		}
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Arguments",
+			Value: strings.Join(args, "\n"),
+		})
+	}
+
+	if len(command.Examples) > 0 {
+		examples := make([]string, 0, len(command.Examples))
+		for _, example := range command.Examples {
+			examples = append(examples, "`"+prefix+example+"`")
+		}
+
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Examples",
+			Value: strings.Join(examples, "\n"),
+		})
+	}
+
+	if len(command.Aliases) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Aliases",
+			Value: prefix + strings.Join(command.Aliases, ", "+prefix),
+		})
+	}
+
+	var notes []string
+
+	if command.Admin {
+		notes = append(notes, "Only server admins can use it in a server")
+	}
+
+	if command.GuildOnly {
+		notes = append(notes, "Only works in a server")
+	}
+
+	if !guild.Enabled(command.Feature) {
+		notes = append(notes, "Disabled on this server")
+	}
+
+	if command.Cooldown > 0 {
+		notes = append(notes, fmt.Sprintf("Can be used once every %v", command.Cooldown))
+	}
+
+	if len(notes) > 0 {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Notes",
+			Value: strings.Join(notes, "\n"),
+		})
+	}
+
+	return embed
+}
+
+// welcomeEmbed introduces the commands a new member can use.
+func (h *Handler) welcomeEmbed(guildName string, guild *models.DiscordGuild) *discordgo.MessageEmbed {
+	prefix := guild.Prefix(h.config.Bot.CommandPrefix)
+	fields := make([]*discordgo.MessageEmbedField, 0, len(h.router.Commands()))
+
+	for _, command := range h.router.Commands() {
+		if command.Admin || command.GuildOnly || !guild.Enabled(command.Feature) || len(command.Args) == 0 {
+			continue
+		}
+
+		value := command.Summary
+		if len(command.Examples) > 0 {
+			value += ", e.g. `" + prefix + command.Examples[0] + "`"
+		}
+
+		fields = append(fields, &discordgo.MessageEmbedField{
+			Name:  command.Usage(prefix),
+			Value: value,
+		})
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Welcome to %s!", guildName),
+		Description: "Thanks for joining! Here's some information to help you get started:",
+		Color:       h.config.Bot.InfoColor,
+		Fields:      fields,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("Type %shelp for every command. We hope you enjoy your stay!", prefix),
+		},
+	}
+}
+
+// available reports whether the command can be used in the guild, or in
+// direct messages for the zero guild.
+func available(command *Command, guild *models.DiscordGuild) bool {
+	if guild.GuildID == "" {
+		return !command.GuildOnly
+	}
+
+	return guild.Enabled(command.Feature)
+}
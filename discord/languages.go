@@ -0,0 +1,287 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bwmarrin/discordgo"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/wikisite"
+)
+
+const (
+	// sitesWindow is how far back stored changes are counted for !languages
+	// and validating !setLang, sitesPeriod names it in replies.
+	sitesWindow = 24 * time.Hour
+	sitesPeriod = "day"
+	sitesTTL    = 10 * time.Minute
+	// maxSuggestions is how many similar languages are offered for a typo.
+	maxSuggestions = 3
+	maxListedSites = 25
+)
+
+// siteCache holds the wikis seen in storage recently, counting them scans
+// every change of the window.
+type siteCache struct {
+	mu      sync.Mutex
+	sites   []models.WikiSite
+	fetched time.Time
+}
+
+func (h *Handler) knownSites(ctx context.Context) ([]models.WikiSite, error) {
+	h.sites.mu.Lock()
+	defer h.sites.mu.Unlock()
+
+	if time.Since(h.sites.fetched) < sitesTTL {
+		return h.sites.sites, nil
+	}
+
+	sites, err := h.db.WikiChanges().GetSites(ctx, time.Now().Add(-sitesWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	h.sites.sites, h.sites.fetched = sites, time.Now()
+
+	return sites, nil
+}
+
+// parseLanguages reads the arguments of !setLang, !addLang and !removeLang:
+// language prefixes each optionally followed by a project, or server names
+// such as fr.wiktionary.org. The project defaults to wikipedia, all stands
+// for every project.
+func parseLanguages(args []string) ([]models.WikiLanguage, error) {
+	var languages []models.WikiLanguage
+
+	for _, arg := range args {
+		arg = strings.ToLower(strings.TrimSpace(arg))
+
+		switch {
+		case arg == "":
+			continue
+		case arg == "all" || wikisite.Projects[arg]:
+			if len(languages) == 0 {
+				return nil, errUsage
+			}
+
+			if arg == "all" {
+				arg = ""
+			}
+
+			languages[len(languages)-1].Project = arg
+		case strings.Contains(arg, "."):
+			site := wikisite.Parse(strings.TrimSuffix(arg, ".org")+".org", "")
+			if site.Project == "" {
+				return nil, userErrorf("%s is not a Wikimedia wiki", arg)
+			}
+
+			languages = append(languages, models.WikiLanguage{Lang: site.Prefix(), Project: site.Project})
+		default:
+			languages = append(languages, models.WikiLanguage{Lang: arg, Project: "wikipedia"})
+		}
+	}
+
+	if len(languages) == 0 {
+		return nil, errUsage
+	}
+
+	unique := languages[:0]
+
+	for _, language := range languages {
+		if !slices.Contains(unique, language) {
+			unique = append(unique, language)
+		}
+	}
+
+	return unique, nil
+}
+
+// validateLanguages checks the languages against the wikis seen in storage
+// and suggests similar ones for those not seen, pointing to !languages with
+// the command prefix in use. Nothing is rejected before any change was
+// stored.
+func (h *Handler) validateLanguages(ctx context.Context, prefix string, languages []models.WikiLanguage) error {
+	sites, err := h.knownSites(ctx)
+	if err != nil {
+		return fmt.Errorf("error while getting known wikis from db: %w", err)
+	}
+
+	if len(sites) == 0 {
+		return nil
+	}
+
+	var problems []string
+
+	for _, language := range languages {
+		if slices.ContainsFunc(sites, func(site models.WikiSite) bool {
+			return matchesSite(language, site)
+		}) {
+			continue
+		}
+
+		problem := fmt.Sprintf("No changes seen for %s in the last %s.", describeLang(language), sitesPeriod)
+
+		if suggestions := suggestLanguages(language, sites); len(suggestions) > 0 {
+			problem += " Did you mean " + strings.Join(suggestions, ", ") + "?"
+		}
+
+		problems = append(problems, problem)
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+
+	problems = append(problems, fmt.Sprintf("Type %slanguages to see the available ones.", prefix))
+
+	return userError{msg: strings.Join(problems, "\n")}
+}
+
+// matchesSite also accepts changes stored before the project was parsed.
+func matchesSite(language models.WikiLanguage, site models.WikiSite) bool {
+	return site.Prefix == language.Lang &&
+		(language.Project == "" || site.Project == "" || site.Project == language.Project)
+}
+
+// suggestLanguages returns the prefixes closest to a mistyped one, the busier
+// wiki first among equally close ones.
+func suggestLanguages(language models.WikiLanguage, sites []models.WikiSite) []string {
+	type candidate struct {
+		name     string
+		distance int
+	}
+
+	var (
+		candidates []candidate
+		seen       = map[string]bool{}
+	)
+
+	limit := max(1, len(language.Lang)/3)
+
+	for _, site := range sites {
+		name := site.Prefix
+		if site.Project != "" && site.Project != language.Project {
+			name += " " + site.Project
+		}
+
+		if seen[name] {
+			continue
+		}
+
+		seen[name] = true
+
+		if distance := levenshtein(language.Lang, site.Prefix); distance <= limit {
+			candidates = append(candidates, candidate{name: name, distance: distance})
+		}
+	}
+
+	// sites are sorted by volume, a stable sort keeps that order
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+
+	suggestions := make([]string, 0, maxSuggestions)
+
+	for _, c := range candidates {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+
+		suggestions = append(suggestions, c.name)
+	}
+
+	return suggestions
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func (h *Handler) languagesEmbed(sites []models.WikiSite, project, prefix string) *discordgo.MessageEmbed {
+	lines := make([]string, 0, maxListedSites)
+
+	for _, site := range sites {
+		if project != "" && site.Project != project {
+			continue
+		}
+
+		if len(lines) == maxListedSites {
+			break
+		}
+
+		lines = append(lines, fmt.Sprintf("%d. %s - %d changes",
+			len(lines)+1, describeLang(models.WikiLanguage{Lang: site.Prefix, Project: site.Project}), site.Changes))
+	}
+
+	description := strings.Join(lines, "\n")
+	if description == "" {
+		description = "No changes stored recently"
+	}
+
+	title := fmt.Sprintf("Most active wikis in the last %s", sitesPeriod)
+	if project != "" {
+		title = fmt.Sprintf("Most active %s languages in the last %s", project, sitesPeriod)
+	}
+
+	return &discordgo.MessageEmbed{
+		Title:       title,
+		Description: description,
+		Color:       h.config.Bot.InfoColor,
+		Footer: &discordgo.MessageEmbedFooter{
+			Text: fmt.Sprintf("%ssetLang <lang code> [project] to follow one", prefix),
+		},
+	}
+}
+
+func describeLang(language models.WikiLanguage) string {
+	switch language.Project {
+	case "":
+		return language.Lang + " (all projects)"
+	case language.Lang:
+		return language.Lang
+	}
+
+	return language.Lang + " " + language.Project
+}
+
+func describeLangs(languages []models.WikiLanguage) string {
+	names := make([]string, 0, len(languages))
+	for _, language := range languages {
+		names = append(names, describeLang(language))
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// defaultWiki is the wiki commands default to, the first of the languages.
+func defaultWiki(languages []models.WikiLanguage) string {
+	return wikisite.ServerName(languages[0].Lang, languages[0].Project)
+}
@@ -0,0 +1,159 @@
+package discord
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Sanjar0126/wiki_change_stream/alert"
+	"github.com/Sanjar0126/wiki_change_stream/analytics"
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Notifier struct {
+	config  *config.Config
+	session *discordgo.Session
+	db      storage.StorageI
+}
+
+func NewNotifier(cfg *config.Config, session *discordgo.Session, db storage.StorageI) *Notifier {
+	return &Notifier{
+		config:  cfg,
+		session: session,
+		db:      db,
+	}
+}
+
+func (n *Notifier) Notify(ctx context.Context, topic, wiki string, embed *discordgo.MessageEmbed) {
+	ctx, span := tracer.Start(ctx, "discord.notify", trace.WithAttributes(
+		attribute.String("topic", topic), attribute.String("wiki", wiki)))
+	defer span.End()
+
+	subscriptions, err := n.db.DiscordSubscription().GetByTopic(ctx, topic, wiki)
+	if err != nil {
+		span.RecordError(err)
+		log.Error("error while getting subscriptions from db", "topic", topic, "wiki", wiki, "error", err)
+
+		return
+	}
+
+	span.SetAttributes(attribute.Int("subscriptions", len(subscriptions)))
+
+	for _, subscription := range subscriptions {
+		_, err := n.session.ChannelMessageSendEmbed(subscription.ChannelID, embed, discordgo.WithContext(ctx))
+		if err != nil {
+			span.RecordError(err)
+			log.Error("error while notifying channel", "topic", topic, "wiki", wiki,
+				"channel", subscription.ChannelID, "error", err)
+		}
+	}
+}
+
+func (n *Notifier) Trending(ctx context.Context, page analytics.TrendingPage) {
+	n.Notify(ctx, repo.TopicTrending, page.Wiki, n.trendingEmbed(page))
+}
+
+func (n *Notifier) EditWar(ctx context.Context, incident models.EditWarIncident) {
+	n.Notify(ctx, repo.TopicEditWar, incident.Wiki, n.editWarEmbed(incident))
+}
+
+// Send delivers an alert to channels subscribed to its kind, so the notifier
+// can be used as an alert sink.
+func (n *Notifier) Send(ctx context.Context, a alert.Alert) error {
+	n.Notify(ctx, a.Kind, a.Wiki, n.alertEmbed(a))
+
+	return nil
+}
+
+func (n *Notifier) trendingEmbed(page analytics.TrendingPage) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Trending on %s: %s", page.Wiki, page.Title),
+		URL:   page.TitleURL,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Edits",
+				Value:  fmt.Sprintf("%d", page.Edits),
+				Inline: true,
+			},
+			{
+				Name:   "Expected",
+				Value:  fmt.Sprintf("%.1f", page.Expected),
+				Inline: true,
+			},
+			{
+				Name:   "Score",
+				Value:  fmt.Sprintf("%.1f", page.Score),
+				Inline: true,
+			},
+		},
+		Color: n.config.Bot.TrendingColor,
+	}
+}
+
+func (n *Notifier) editWarEmbed(incident models.EditWarIncident) *discordgo.MessageEmbed {
+	return &discordgo.MessageEmbed{
+		Title: fmt.Sprintf("Possible edit war on %s: %s", incident.Wiki, incident.Title),
+		URL:   incident.TitleURL,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "Users",
+				Value:  strings.Join(incident.Users, ", "),
+				Inline: false,
+			},
+			{
+				Name:   "Reverts",
+				Value:  fmt.Sprintf("%d", incident.Reverts),
+				Inline: true,
+			},
+			{
+				Name:   "Since",
+				Value:  incident.StartedAt.Format("2006-01-02 15:04:05"),
+				Inline: true,
+			},
+		},
+		Color: n.config.Bot.AlertColor,
+	}
+}
+
+func (n *Notifier) alertEmbed(a alert.Alert) *discordgo.MessageEmbed {
+	embed := &discordgo.MessageEmbed{
+		Title:       fmt.Sprintf("Possible %s on %s: %s", a.Kind, a.Wiki, a.Title),
+		URL:         a.TitleURL,
+		Description: a.Summary,
+		Fields: []*discordgo.MessageEmbedField{
+			{
+				Name:   "User",
+				Value:  a.User,
+				Inline: true,
+			},
+			{
+				Name:   "Size",
+				Value:  fmt.Sprintf("%d -> %d", a.OldLength, a.NewLength),
+				Inline: true,
+			},
+		},
+		Color: n.config.Bot.AlertColor,
+	}
+
+	if a.Comment != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Comment",
+			Value: a.Comment,
+		})
+	}
+
+	if a.DiffURL != "" {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:  "Diff",
+			Value: a.DiffURL,
+		})
+	}
+
+	return embed
+}
@@ -0,0 +1,432 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/bwmarrin/discordgo"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/metrics"
+)
+
+var (
+	meter = metrics.Meter("discord")
+
+	commandCount, _ = meter.Int64Counter("discord.commands",
+		metric.WithDescription("Commands handled, by command and result"))
+	commandDuration, _ = meter.Float64Histogram("discord.command.duration", metric.WithUnit("s"),
+		metric.WithDescription("Time spent handling a command"))
+)
+
+// errUsage makes the router answer with the usage and examples of the
+// command.
+var errUsage = errors.New("usage")
+
+// userError is shown to the user as it is instead of being logged.
+type userError struct {
+	msg string
+}
+
+func (e userError) Error() string {
+	return e.msg
+}
+
+func userErrorf(format string, args ...interface{}) error {
+	return userError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Arg describes an argument of a command, for parsing and for help.
+type Arg struct {
+	Name     string
+	Help     string
+	Required bool
+	// Variadic takes the remaining words, only the last argument can be.
+	Variadic bool
+}
+
+// Command is the definition of a chat command.
+type Command struct {
+	Name     string
+	Aliases  []string
+	Summary  string
+	Args     []Arg
+	Examples []string
+	// Feature lets guilds disable the command, see models.GuildFeatures.
+	Feature string
+	// Admin limits the command to guild admins when used in a guild.
+	Admin     bool
+	GuildOnly bool
+	// AnyChannel answers outside the channels a guild allows.
+	AnyChannel bool
+	// LoadUser loads the author's settings into CommandContext.User.
+	LoadUser bool
+	// Cooldown is the time a user has to wait between two uses.
+	Cooldown time.Duration
+	Run      HandlerFunc
+}
+
+// Usage returns the syntax of the command, e.g. !recent [offset] [limit].
+func (c *Command) Usage(prefix string) string {
+	parts := []string{prefix + c.Name}
+
+	for _, arg := range c.Args {
+		name := arg.Name
+		if arg.Variadic {
+			name += "..."
+		}
+
+		if arg.Required {
+			parts = append(parts, "<"+name+">")
+		} else {
+			parts = append(parts, "["+name+"]")
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// CommandContext is one invocation of a command.
+type CommandContext struct {
+	Ctx     context.Context
+	Session *discordgo.Session
+	Message *discordgo.MessageCreate
+	Command *Command
+	Prefix  string
+	Guild   *models.DiscordGuild
+	User    *models.DiscordUser
+	Log     *slog.Logger
+
+	args map[string][]string
+}
+
+// Arg returns the value of a named argument, empty when it was not given.
+func (c *CommandContext) Arg(name string) string {
+	if values := c.args[name]; len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// Args returns every value of a variadic argument.
+func (c *CommandContext) Args(name string) []string {
+	return c.args[name]
+}
+
+func (c *CommandContext) Reply(text string) error {
+	_, err := c.Session.ChannelMessageSend(c.Message.ChannelID, text, discordgo.WithContext(c.Ctx))
+	return err
+}
+
+func (c *CommandContext) ReplyEmbed(embeds ...*discordgo.MessageEmbed) error {
+	_, err := c.Session.ChannelMessageSendEmbeds(c.Message.ChannelID, embeds, discordgo.WithContext(c.Ctx))
+	return err
+}
+
+type HandlerFunc func(c *CommandContext) error
+
+// Middleware wraps the handling of every command.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// Router finds the command of a message and runs it through the middleware.
+type Router struct {
+	commands   []*Command
+	names      map[string]*Command
+	middleware []Middleware
+	cooldowns  *cooldowns
+}
+
+func NewRouter() *Router {
+	return &Router{
+		names:     make(map[string]*Command),
+		cooldowns: &cooldowns{until: make(map[string]time.Time)},
+	}
+}
+
+// Register adds commands, their names and aliases are matched case
+// insensitively.
+func (r *Router) Register(commands ...*Command) {
+	for _, command := range commands {
+		for _, name := range append([]string{command.Name}, command.Aliases...) {
+			name = strings.ToLower(name)
+			if _, ok := r.names[name]; ok {
+				panic(fmt.Sprintf("discord: command %s registered twice", name))
+			}
+
+			r.names[name] = command
+		}
+
+		r.commands = append(r.commands, command)
+	}
+}
+
+// Use adds middleware, the first one added runs first.
+func (r *Router) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// Commands returns the registered commands in the order they were added.
+func (r *Router) Commands() []*Command {
+	return r.commands
+}
+
+// Lookup finds a command by its name or an alias.
+func (r *Router) Lookup(name string) (*Command, bool) {
+	command, ok := r.names[strings.ToLower(name)]
+	return command, ok
+}
+
+// Parse splits a message into the command and its arguments. It reports
+// false when the message is not a known command.
+func (r *Router) Parse(content, prefix string) (*Command, []string, bool) {
+	content, ok := strings.CutPrefix(content, prefix)
+	if !ok {
+		return nil, nil, false
+	}
+
+	words := splitArgs(content)
+	if len(words) == 0 {
+		return nil, nil, false
+	}
+
+	command, ok := r.Lookup(words[0])
+
+	return command, words[1:], ok
+}
+
+// Run binds the words to the command's arguments and handles it.
+func (r *Router) Run(c *CommandContext, words []string) error {
+	handler := func(c *CommandContext) error {
+		args, ok := bindArgs(c.Command.Args, words)
+		if !ok {
+			return errUsage
+		}
+
+		c.args = args
+
+		return c.Command.Run(c)
+	}
+
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		handler = r.middleware[i](handler)
+	}
+
+	return handler(c)
+}
+
+func bindArgs(schema []Arg, words []string) (map[string][]string, bool) {
+	args := make(map[string][]string, len(schema))
+
+	for i, arg := range schema {
+		switch {
+		case i >= len(words):
+			if arg.Required {
+				return nil, false
+			}
+		case arg.Variadic:
+			args[arg.Name] = words[i:]
+			return args, true
+		default:
+			args[arg.Name] = words[i : i+1]
+		}
+	}
+
+	return args, len(words) <= len(schema)
+}
+
+// splitArgs splits on any whitespace, words in double quotes stay together.
+func splitArgs(content string) []string {
+	var (
+		words   []string
+		word    strings.Builder
+		quoted  bool
+		started bool
+	)
+
+	for _, r := range content {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				words = append(words, word.String())
+				word.Reset()
+				started = false
+			}
+		default:
+			word.WriteRune(r)
+			started = true
+		}
+	}
+
+	if started {
+		words = append(words, word.String())
+	}
+
+	return words
+}
+
+// replyErrors answers usage and user errors and reports the others without
+// their details.
+func replyErrors(next HandlerFunc) HandlerFunc {
+	return func(c *CommandContext) error {
+		err := next(c)
+
+		var (
+			reply string
+			user  userError
+		)
+
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, errUsage):
+			reply = "Usage: " + c.Command.Usage(c.Prefix)
+			for _, example := range c.Command.Examples {
+				reply += "\nExample: " + c.Prefix + example
+			}
+		case errors.As(err, &user):
+			reply = user.msg
+		default:
+			reply = "Something went wrong, please try again later"
+		}
+
+		if replyErr := c.Reply(reply); replyErr != nil {
+			c.Log.Error("error while sending message", "error", replyErr)
+		}
+
+		return err
+	}
+}
+
+// instrument records the outcome of every command on its span and in the
+// command metrics.
+func instrument(next HandlerFunc) HandlerFunc {
+	return func(c *CommandContext) error {
+		start := time.Now()
+		err := next(c)
+
+		var user userError
+
+		result := "ok"
+
+		switch {
+		case errors.Is(err, errUsage) || errors.As(err, &user):
+			result = "rejected"
+		case err != nil:
+			result = "error"
+			span := trace.SpanFromContext(c.Ctx)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "command failed")
+			c.Log.Error("command failed", "error", err)
+		}
+
+		attrs := metric.WithAttributes(attribute.String("command", c.Command.Name))
+		commandCount.Add(c.Ctx, 1, metric.WithAttributes(
+			attribute.String("command", c.Command.Name), attribute.String("result", result)))
+		commandDuration.Record(c.Ctx, time.Since(start).Seconds(), attrs)
+
+		return err
+	}
+}
+
+// checkGuild enforces the guild settings: disabled features, commands only
+// meant for guilds and the ones only admins may use.
+func checkGuild(next HandlerFunc) HandlerFunc {
+	return func(c *CommandContext) error {
+		guild, command := c.Guild, c.Command
+
+		switch {
+		case command.GuildOnly && guild.GuildID == "":
+			return userErrorf("%s%s only works in a server", c.Prefix, command.Name)
+		case !guild.Enabled(command.Feature):
+			return userErrorf("%s%s is disabled on this server", c.Prefix, command.Name)
+		case command.Admin && guild.GuildID != "":
+			admin, err := isAdmin(c.Session, c.Message, guild)
+			if err != nil {
+				return fmt.Errorf("error while checking permissions: %w", err)
+			}
+
+			if !admin {
+				return userErrorf("Only server admins can use %s%s", c.Prefix, command.Name)
+			}
+		}
+
+		return next(c)
+	}
+}
+
+func (r *Router) cooldown(next HandlerFunc) HandlerFunc {
+	return func(c *CommandContext) error {
+		if c.Command.Cooldown > 0 {
+			if wait := r.cooldowns.take(c.Command.Name+"|"+c.Message.Author.ID, c.Command.Cooldown); wait > 0 {
+				return userErrorf("Slow down, you can use %s%s again in %v",
+					c.Prefix, c.Command.Name, wait.Round(time.Second))
+			}
+		}
+
+		return next(c)
+	}
+}
+
+// loadUser is the middleware giving commands the author's settings.
+func (h *Handler) loadUser(next HandlerFunc) HandlerFunc {
+	return func(c *CommandContext) error {
+		if c.Command.LoadUser {
+			user, err := h.db.DiscordUser().GetOrCreate(c.Ctx, c.Message.Author.ID)
+			if err != nil {
+				return fmt.Errorf("error while getting user from db: %w", err)
+			}
+
+			c.User = user
+		}
+
+		return next(c)
+	}
+}
+
+// cooldownPrune is the number of entries after which expired ones are
+// dropped.
+const cooldownPrune = 1024
+
+type cooldowns struct {
+	mu    sync.Mutex
+	until map[string]time.Time
+}
+
+// take starts the cooldown of key, or returns how long the running one
+// still lasts.
+func (c *cooldowns) take(key string, cooldown time.Duration) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+
+	if until, ok := c.until[key]; ok && now.Before(until) {
+		return until.Sub(now)
+	}
+
+	if len(c.until) >= cooldownPrune {
+		for k, until := range c.until {
+			if now.After(until) {
+				delete(c.until, k)
+			}
+		}
+	}
+
+	c.until[key] = now.Add(cooldown)
+
+	return 0
+}
@@ -0,0 +1,205 @@
+package discord
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"recent", []string{"recent"}},
+		{"recent 10  5", []string{"recent", "10", "5"}},
+		{"recent\t10\n5", []string{"recent", "10", "5"}},
+		{`search "Main Page" en`, []string{"search", "Main Page", "en"}},
+		{`search a"b c"d`, []string{"search", "ab cd"}},
+		{`say ""`, []string{"say", ""}},
+		{`say "unterminated quote`, []string{"say", "unterminated quote"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			if got := splitArgs(tt.content); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitArgs(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBindArgs(t *testing.T) {
+	var (
+		optional = []Arg{{Name: "offset"}, {Name: "limit"}}
+		required = []Arg{{Name: "lang", Required: true}, {Name: "limit"}}
+		variadic = []Arg{{Name: "action", Required: true}, {Name: "langs", Variadic: true}}
+	)
+
+	tests := []struct {
+		name   string
+		schema []Arg
+		words  []string
+		want   map[string][]string
+		ok     bool
+	}{
+		{"no arguments", nil, nil, map[string][]string{}, true},
+		{"unexpected word", nil, []string{"x"}, nil, false},
+		{"optional left out", optional, nil, map[string][]string{}, true},
+		{"optional in part", optional, []string{"5"}, map[string][]string{"offset": {"5"}}, true},
+		{"optional given", optional, []string{"5", "10"},
+			map[string][]string{"offset": {"5"}, "limit": {"10"}}, true},
+		{"too many words", optional, []string{"5", "10", "15"}, nil, false},
+		{"required missing", required, nil, nil, false},
+		{"required given", required, []string{"en"}, map[string][]string{"lang": {"en"}}, true},
+		{"variadic left out", variadic, []string{"add"}, map[string][]string{"action": {"add"}}, true},
+		{"variadic takes the rest", variadic, []string{"add", "en", "de", "fr"},
+			map[string][]string{"action": {"add"}, "langs": {"en", "de", "fr"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := bindArgs(tt.schema, tt.words)
+			if ok != tt.ok {
+				t.Fatalf("bindArgs(%q) ok = %t, want %t", tt.words, ok, tt.ok)
+			}
+
+			if ok && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bindArgs(%q) = %q, want %q", tt.words, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterParse(t *testing.T) {
+	recent := &Command{Name: "recent", Aliases: []string{"r"}}
+	follow := &Command{Name: "follow"}
+
+	r := NewRouter()
+	r.Register(recent, follow)
+
+	tests := []struct {
+		content string
+		command *Command
+		words   []string
+		ok      bool
+	}{
+		{"!recent", recent, []string{}, true},
+		{"!recent 5 10", recent, []string{"5", "10"}, true},
+		{"!RECENT 5", recent, []string{"5"}, true},
+		{"!r 5", recent, []string{"5"}, true},
+		{`!follow "en wiktionary"`, follow, []string{"en wiktionary"}, true},
+		{"! recent", recent, []string{}, true},
+		{"!unknown 5", nil, []string{"5"}, false},
+		{"recent 5", nil, nil, false},
+		{"?recent", nil, nil, false},
+		{"!", nil, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			command, words, ok := r.Parse(tt.content, "!")
+			if ok != tt.ok || command != tt.command {
+				t.Fatalf("Parse(%q) = %v, %t, want %v, %t", tt.content, command, ok, tt.command, tt.ok)
+			}
+
+			if ok && !reflect.DeepEqual(words, tt.words) {
+				t.Errorf("Parse(%q) words = %q, want %q", tt.content, words, tt.words)
+			}
+		})
+	}
+}
+
+func TestRegisterTwicePanics(t *testing.T) {
+	r := NewRouter()
+	r.Register(&Command{Name: "recent", Aliases: []string{"r"}})
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering an alias twice did not panic")
+		}
+	}()
+
+	r.Register(&Command{Name: "R"})
+}
+
+func TestCommandUsage(t *testing.T) {
+	tests := []struct {
+		args []Arg
+		want string
+	}{
+		{nil, "!recent"},
+		{[]Arg{{Name: "offset"}, {Name: "limit"}}, "!recent [offset] [limit]"},
+		{[]Arg{{Name: "lang", Required: true}}, "!recent <lang>"},
+		{[]Arg{{Name: "action", Required: true}, {Name: "langs", Variadic: true}}, "!recent <action> [langs...]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			command := &Command{Name: "recent", Args: tt.args}
+
+			if got := command.Usage("!"); got != tt.want {
+				t.Errorf("Usage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterRun(t *testing.T) {
+	var calls []string
+
+	record := func(name string) Middleware {
+		return func(next HandlerFunc) HandlerFunc {
+			return func(c *CommandContext) error {
+				calls = append(calls, name)
+				return next(c)
+			}
+		}
+	}
+
+	command := &Command{
+		Name: "follow",
+		Args: []Arg{{Name: "action", Required: true}, {Name: "langs", Variadic: true}},
+		Run: func(c *CommandContext) error {
+			calls = append(calls, "run "+c.Arg("action")+" "+c.Arg("missing"))
+
+			if len(c.Args("langs")) != 2 {
+				return errors.New("unexpected langs")
+			}
+
+			return nil
+		},
+	}
+
+	r := NewRouter()
+	r.Register(command)
+	r.Use(record("first"), record("second"))
+
+	tests := []struct {
+		name  string
+		words []string
+		calls []string
+		err   error
+	}{
+		{"bound", []string{"add", "en", "de"}, []string{"first", "second", "run add "}, nil},
+		{"usage", nil, []string{"first", "second"}, errUsage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+
+			err := r.Run(&CommandContext{Ctx: context.Background(), Command: command}, tt.words)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Run error = %v, want %v", err, tt.err)
+			}
+
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("calls = %q, want %q", calls, tt.calls)
+			}
+		})
+	}
+}
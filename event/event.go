@@ -7,60 +7,103 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/tracing"
+)
+
+var (
+	log    = logger.For("event")
+	tracer = tracing.Tracer("event")
 )
 
-type ConsumerConfig struct {
-	URL                string
-	ReconnectDelay     time.Duration
-	GetLatestTimestamp func() string
+type ConsumerConfig[T any] struct {
+	URL            string
+	ReconnectDelay time.Duration
+	// GetLatestTimestamp tells where to continue after a reconnect, and on
+	// the first connect too when ResumeOnStart is set. A zero time starts
+	// from the newest event.
+	GetLatestTimestamp func(ctx context.Context) (time.Time, error)
+	ResumeOnStart      bool
 	MaxRetries         int
+	// Decode turns the data of a single event into T, plain json.Unmarshal
+	// is used when it is nil.
+	Decode func(data []byte) (T, error)
+	// OnReject receives the raw data of events that could not be decoded.
+	OnReject func(ctx context.Context, data []byte, err error)
+}
+
+// Message is a decoded event along with the context holding its trace span.
+// The span covers the event from decoding until Done is called by whoever
+// finishes processing it.
+type Message[T any] struct {
+	Ctx   context.Context
+	Event T
+}
+
+func (m Message[T]) Done() {
+	trace.SpanFromContext(m.Ctx).End()
 }
 
 func ConsumeEvents[T any](
-	ctx context.Context, config ConsumerConfig, eventChan chan<- T, wg *sync.WaitGroup) {
+	ctx context.Context, config ConsumerConfig[T], eventChan chan<- Message[T], wg *sync.WaitGroup) {
 	defer wg.Done()
 	defer close(eventChan)
 
 	retries := 0
-	isReconnecting := false
+	isReconnecting := config.ResumeOnStart
+	streamLog := log.With("stream", config.URL)
 
 	for {
 		select {
 		case <-ctx.Done():
-			log.Printf("Context canceled, stopping consumer")
+			streamLog.Info("context cancelled, stopping consumer")
 			return
 		default:
 			url := config.URL
 
 			if isReconnecting {
-				timestamp := config.GetLatestTimestamp()
-				if timestamp != "" {
-					log.Printf("Reconnecting: Using timestamp %s", timestamp)
+				timestamp, err := config.GetLatestTimestamp(ctx)
+				if err != nil {
+					streamLog.Warn("error getting latest timestamp, resuming from now", "error", err)
+				}
+
+				if !timestamp.IsZero() {
+					since := timestamp.UTC().Format(time.RFC3339Nano)
+					streamLog.Info("resuming stream", "since", since, "attempt", retries)
 
 					if strings.Contains(url, "?") {
-						url += "&since=" + timestamp
+						url += "&since=" + since
 					} else {
-						url += "?since=" + timestamp
+						url += "?since=" + since
 					}
 				}
 			}
 
-			err := consumeEventStream(ctx, url, eventChan)
+			err := consumeEventStream(ctx, config, url, eventChan)
+
+			if ctx.Err() != nil {
+				streamLog.Info("context cancelled, stopping consumer")
+				return
+			}
 
 			if err != nil {
 				retries++
 				if config.MaxRetries > 0 && retries >= config.MaxRetries {
-					log.Printf("Max retries (%d) reached, stopping consumer", config.MaxRetries)
+					streamLog.Error("max retries reached, stopping consumer",
+						"error", err, "attempt", retries)
 					return
 				}
 
-				log.Printf("Stream ended or error occurred: %v", err)
-				log.Printf("Attempting reconnection #%d in %v...", retries, config.ReconnectDelay)
+				streamLog.Warn("stream interrupted, reconnecting",
+					"error", err, "attempt", retries, "delay", config.ReconnectDelay)
 
 				isReconnecting = true
 
@@ -78,8 +121,9 @@ func ConsumeEvents[T any](
 	}
 }
 
-func consumeEventStream[T any](ctx context.Context, url string, eventChan chan<- T) error {
-	log.Println("Connecting to event stream:", url)
+func consumeEventStream[T any](
+	ctx context.Context, config ConsumerConfig[T], url string, eventChan chan<- Message[T]) error {
+	log.Info("connecting to event stream", "stream", config.URL, "url", url)
 
 	client := &http.Client{}
 	req, err := http.NewRequest("GET", url, nil)
@@ -100,7 +144,37 @@ func consumeEventStream[T any](ctx context.Context, url string, eventChan chan<-
 		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	reader := bufio.NewReaderSize(resp.Body, 16*1024)
+	err = readEvents(ctx, config, resp.Body, eventChan)
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("stream ended")
+	}
+
+	return err
+}
+
+// ReplayFile feeds events recorded from the stream (SSE "data: " lines) or
+// written one JSON object per line into eventChan, closing it when done.
+func ReplayFile[T any](
+	ctx context.Context, config ConsumerConfig[T], path string, eventChan chan<- Message[T]) error {
+	defer close(eventChan)
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening file: %w", err)
+	}
+	defer file.Close()
+
+	err = readEvents(ctx, config, file, eventChan)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	return err
+}
+
+func readEvents[T any](
+	ctx context.Context, config ConsumerConfig[T], r io.Reader, eventChan chan<- Message[T]) error {
+	reader := bufio.NewReaderSize(r, 16*1024)
 	buffer := strings.Builder{}
 
 	for {
@@ -117,32 +191,33 @@ func consumeEventStream[T any](ctx context.Context, url string, eventChan chan<-
 					event := buffer.String()
 					buffer.Reset()
 
-					if err := handleEvent(event, eventChan); err != nil {
-						log.Printf("Error processing event: %v", err)
+					if err := handleEvent(ctx, config, event, eventChan); err != nil {
+						log.Warn("error processing event", "error", err)
 					}
 				}
 			}
 
 			if err != nil {
-				if errors.Is(err, io.EOF) {
-					return fmt.Errorf("stream ended")
-				}
-
 				if buffer.Len() > 0 {
-					if err := handleEvent(buffer.String(), eventChan); err != nil {
-						log.Printf("Error processing remaining buffer: %v", err)
+					if err := handleEvent(ctx, config, buffer.String(), eventChan); err != nil {
+						log.Warn("error processing remaining buffer", "error", err)
 					}
 
 					buffer.Reset()
 				}
 
+				if errors.Is(err, io.EOF) {
+					return err
+				}
+
 				return fmt.Errorf("error reading: %w", err)
 			}
 		}
 	}
 }
 
-func handleEvent[T any](eventStr string, eventChan chan<- T) error {
+func handleEvent[T any](
+	ctx context.Context, config ConsumerConfig[T], eventStr string, eventChan chan<- Message[T]) error {
 	eventStr = strings.TrimSpace(eventStr)
 	if eventStr == "" {
 		return nil
@@ -156,6 +231,8 @@ func handleEvent[T any](eventStr string, eventChan chan<- T) error {
 		if strings.HasPrefix(line, "data: ") {
 			data := strings.TrimPrefix(line, "data: ")
 			dataLines = append(dataLines, data)
+		} else if strings.HasPrefix(line, "{") {
+			dataLines = append(dataLines, line)
 		}
 	}
 
@@ -163,14 +240,45 @@ func handleEvent[T any](eventStr string, eventChan chan<- T) error {
 		return nil
 	}
 
-	completeData := strings.Join(dataLines, "")
+	completeData := []byte(strings.Join(dataLines, ""))
 
-	var event T
-	if err := json.Unmarshal([]byte(completeData), &event); err != nil {
-		return fmt.Errorf("error unmarshaling event: %w", err)
+	ctx, span := tracer.Start(ctx, "event")
+	_, decodeSpan := tracer.Start(ctx, "event.decode")
+
+	event, err := decode(config, completeData)
+
+	tracing.End(decodeSpan, err)
+
+	if err != nil {
+		if config.OnReject != nil {
+			config.OnReject(ctx, completeData, err)
+		}
+
+		tracing.End(span, err)
+
+		return err
+	}
+
+	// the event outlives the consumer when it stops, processing it during
+	// shutdown must not be cancelled along with reading
+	select {
+	case eventChan <- Message[T]{Ctx: context.WithoutCancel(ctx), Event: event}:
+		return nil
+	case <-ctx.Done():
+		tracing.End(span, ctx.Err())
+		return fmt.Errorf("event dropped: %w", ctx.Err())
+	}
+}
+
+func decode[T any](config ConsumerConfig[T], data []byte) (T, error) {
+	if config.Decode != nil {
+		return config.Decode(data)
 	}
 
-	eventChan <- event
+	var event T
+	if err := json.Unmarshal(data, &event); err != nil {
+		return event, fmt.Errorf("error unmarshaling event: %w", err)
+	}
 
-	return nil
+	return event, nil
 }
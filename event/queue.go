@@ -0,0 +1,494 @@
+package event
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/metrics"
+)
+
+type Overflow string
+
+const (
+	// OverflowBlock stops taking events until the processor catches up, the
+	// stream reader waits meanwhile.
+	OverflowBlock Overflow = "block"
+	// OverflowDropOldest makes room by dropping the longest queued event.
+	OverflowDropOldest Overflow = "drop-oldest"
+	// OverflowDropNewest drops the events arriving while the queue is full.
+	OverflowDropNewest Overflow = "drop-newest"
+	// OverflowSpill appends the events arriving while the queue is full to a
+	// file and feeds them back in order once there is room again. The file
+	// outlives the process: what is left in it is fed in first on the next
+	// start.
+	OverflowSpill Overflow = "spill"
+)
+
+type QueueConfig struct {
+	Size     int
+	Overflow Overflow
+	// SpillDir holds the spill file, it must persist across restarts.
+	SpillDir string
+	// SpillMaxBytes caps the spill file, newer events are dropped beyond it.
+	SpillMaxBytes int64
+}
+
+var (
+	meter = metrics.Meter("event")
+
+	queueDepth, _ = meter.Int64ObservableGauge("event.queue.depth",
+		metric.WithDescription("Events waiting for the processor, in memory or spilled to disk"))
+	queueDropped, _ = meter.Int64Counter("event.queue.dropped",
+		metric.WithDescription("Events dropped because the queue was full"))
+	queueSpilled, _ = meter.Int64Counter("event.queue.spilled",
+		metric.WithDescription("Events written to the spill file"))
+)
+
+// Queue buffers messages between the consumer and the processor, so slow
+// processing only stalls reading the stream once Size events are waiting and
+// the overflow policy is block.
+type Queue[T any] struct {
+	config   QueueConfig
+	name     string
+	buffer   []Message[T]
+	spill    *spillFile
+	memory   atomic.Int64
+	disk     atomic.Int64
+	overflow bool
+}
+
+// NewQueue returns a queue reporting its metrics under name.
+func NewQueue[T any](name string, config QueueConfig) *Queue[T] {
+	if config.Size <= 0 {
+		config.Size = 1
+	}
+
+	q := &Queue[T]{
+		config: config,
+		name:   name,
+		buffer: make([]Message[T], 0, config.Size),
+	}
+
+	if config.Overflow == OverflowSpill {
+		q.restoreSpill()
+	}
+
+	_, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(queueDepth, q.memory.Load(), metric.WithAttributes(
+			attribute.String("queue", q.name), attribute.String("location", "memory")))
+		o.ObserveInt64(queueDepth, q.disk.Load(), metric.WithAttributes(
+			attribute.String("queue", q.name), attribute.String("location", "disk")))
+
+		return nil
+	}, queueDepth)
+	if err != nil {
+		log.Warn("error registering queue metrics", "queue", name, "error", err)
+	}
+
+	return q
+}
+
+// Run moves messages from in to out until in is closed and everything
+// queued was delivered, then closes out. Once ctx is cancelled a spilling
+// queue stops delivering and keeps what it holds, along with what still
+// arrives on in, in the spill file for the next start.
+func (q *Queue[T]) Run(ctx context.Context, in <-chan Message[T], out chan<- Message[T], wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer close(out)
+
+	var stop <-chan struct{}
+	if q.config.Overflow == OverflowSpill {
+		stop = ctx.Done()
+	}
+
+	stopped := false
+
+	q.refill()
+
+	for in != nil || (len(q.buffer) > 0 && !stopped) {
+		var (
+			receive = in
+			send    chan<- Message[T]
+			next    Message[T]
+		)
+
+		if len(q.buffer) > 0 && !stopped {
+			send = out
+			next = q.buffer[0]
+		}
+
+		if len(q.buffer) >= q.config.Size && q.config.Overflow == OverflowBlock {
+			receive = nil
+		}
+
+		select {
+		case <-stop:
+			stop, stopped = nil, true
+		case msg, ok := <-receive:
+			if !ok {
+				in = nil
+				continue
+			}
+
+			if stopped {
+				q.spillOrDrop(msg)
+				continue
+			}
+
+			q.push(msg)
+		case send <- next:
+			q.buffer[0] = Message[T]{}
+			q.buffer = q.buffer[1:]
+			q.refill()
+		}
+
+		q.memory.Store(int64(len(q.buffer)))
+	}
+
+	if stopped {
+		q.keepSpill()
+		return
+	}
+
+	q.closeSpill()
+}
+
+func (q *Queue[T]) push(msg Message[T]) {
+	spilling := q.spill != nil && q.spill.count > 0
+
+	if len(q.buffer) < q.config.Size && !spilling {
+		q.buffer = append(q.buffer, msg)
+		q.overflow = false
+
+		return
+	}
+
+	if !q.overflow {
+		q.overflow = true
+		log.Warn("queue full", "queue", q.name, "size", q.config.Size, "overflow", q.config.Overflow)
+	}
+
+	switch q.config.Overflow {
+	case OverflowDropOldest:
+		q.drop(q.buffer[0], "oldest")
+		q.buffer[0] = Message[T]{}
+		q.buffer = append(q.buffer[1:], msg)
+	case OverflowSpill:
+		q.spillOrDrop(msg)
+	default:
+		q.drop(msg, "newest")
+	}
+}
+
+// refill moves the oldest spilled events into memory while there is room,
+// the spill file only ever holds events newer than everything in memory.
+func (q *Queue[T]) refill() {
+	for q.spill != nil && q.spill.count > 0 && len(q.buffer) < q.config.Size {
+		data, err := q.spill.read()
+		if err != nil {
+			log.Error("error reading spilled event, dropping the spill file",
+				"queue", q.name, "dropped", q.spill.count, "error", err)
+			queueDropped.Add(context.Background(), int64(q.spill.count), metric.WithAttributes(
+				attribute.String("queue", q.name), attribute.String("reason", "spill_failed")))
+			q.spill.reset()
+			q.disk.Store(0)
+
+			return
+		}
+
+		q.disk.Store(int64(q.spill.count))
+
+		var event T
+		if err := json.Unmarshal(data, &event); err != nil {
+			log.Error("error decoding spilled event, dropping it", "queue", q.name, "error", err)
+			queueDropped.Add(context.Background(), 1, metric.WithAttributes(
+				attribute.String("queue", q.name), attribute.String("reason", "spill_decode")))
+
+			continue
+		}
+
+		// the span of a spilled event ended when it was written out
+		q.buffer = append(q.buffer, Message[T]{Ctx: context.Background(), Event: event})
+	}
+}
+
+func (q *Queue[T]) spillOrDrop(msg Message[T]) {
+	if err := q.spillMessage(msg); err != nil {
+		log.Error("error spilling event to disk", "queue", q.name, "error", err)
+		q.drop(msg, "spill_failed")
+	}
+}
+
+func (q *Queue[T]) spillMessage(msg Message[T]) error {
+	if q.spill == nil {
+		spill, err := openSpillFile(spillPath(q.config.SpillDir, q.name))
+		if err != nil {
+			return err
+		}
+
+		q.spill = spill
+	}
+
+	data, err := json.Marshal(msg.Event)
+	if err != nil {
+		return err
+	}
+
+	if q.spill.size+int64(len(data))+1 > q.config.SpillMaxBytes {
+		q.drop(msg, "spill_full")
+		return nil
+	}
+
+	if err := q.spill.write(data); err != nil {
+		return err
+	}
+
+	trace.SpanFromContext(msg.Ctx).SetAttributes(attribute.Bool("queue.spilled", true))
+	msg.Done()
+
+	q.disk.Store(int64(q.spill.count))
+	queueSpilled.Add(context.Background(), 1, metric.WithAttributes(attribute.String("queue", q.name)))
+
+	return nil
+}
+
+func (q *Queue[T]) drop(msg Message[T], reason string) {
+	trace.SpanFromContext(msg.Ctx).SetAttributes(attribute.String("queue.dropped", reason))
+	msg.Done()
+
+	queueDropped.Add(context.Background(), 1, metric.WithAttributes(
+		attribute.String("queue", q.name), attribute.String("reason", reason)))
+}
+
+// restoreSpill opens the spill file left by the last run, its events are
+// delivered before any new one.
+func (q *Queue[T]) restoreSpill() {
+	path := spillPath(q.config.SpillDir, q.name)
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return
+	}
+
+	spill, err := openSpillFile(path)
+	if err != nil {
+		log.Error("error opening spill file left from the last run", "queue", q.name, "file", path, "error", err)
+		return
+	}
+
+	q.spill = spill
+	q.disk.Store(int64(spill.count))
+
+	if spill.count > 0 {
+		log.Info("replaying events spilled in the last run", "queue", q.name, "events", spill.count)
+	}
+}
+
+// closeSpill removes the spill file once everything in it was delivered.
+func (q *Queue[T]) closeSpill() {
+	if q.spill == nil {
+		return
+	}
+
+	if err := q.spill.close(); err != nil {
+		log.Warn("error removing spill file", "queue", q.name, "error", err)
+	}
+}
+
+// keepSpill writes the events still in memory in front of the ones not read
+// from the spill file yet, so the next start delivers them in order.
+func (q *Queue[T]) keepSpill() {
+	var front []byte
+
+	for _, msg := range q.buffer {
+		data, err := json.Marshal(msg.Event)
+		if err != nil {
+			q.drop(msg, "spill_failed")
+			continue
+		}
+
+		front = append(append(front, data...), '\n')
+
+		msg.Done()
+	}
+
+	kept := len(q.buffer)
+	q.buffer = nil
+	q.memory.Store(0)
+
+	if q.spill == nil {
+		if kept == 0 {
+			return
+		}
+
+		spill, err := openSpillFile(spillPath(q.config.SpillDir, q.name))
+		if err != nil {
+			log.Error("error keeping queued events", "queue", q.name, "dropped", kept, "error", err)
+			return
+		}
+
+		q.spill = spill
+	}
+
+	kept += q.spill.count
+
+	if err := q.spill.keep(front); err != nil {
+		log.Error("error keeping queued events in the spill file", "queue", q.name, "error", err)
+		return
+	}
+
+	log.Info("kept queued events in the spill file for the next start", "queue", q.name,
+		"events", kept, "file", q.spill.path)
+}
+
+func spillPath(dir, name string) string {
+	return filepath.Join(dir, name+"-spill.ndjson")
+}
+
+// spillFile is an append-only file of JSON lines read back from the start,
+// it is truncated whenever everything written was read.
+type spillFile struct {
+	path   string
+	writer *os.File
+	reader *os.File
+	buffer *bufio.Reader
+	size   int64
+	count  int
+}
+
+// openSpillFile opens or creates the spill file at path. The lines already
+// in it are counted, a line torn by a crash is cut off.
+func openSpillFile(path string) (*spillFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("error creating spill directory: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("error reading spill file: %w", err)
+	}
+
+	complete := bytes.LastIndexByte(data, '\n') + 1
+
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error creating spill file: %w", err)
+	}
+
+	if complete < len(data) {
+		if err := writer.Truncate(int64(complete)); err != nil {
+			writer.Close()
+			return nil, fmt.Errorf("error cutting off torn spilled event: %w", err)
+		}
+	}
+
+	reader, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("error opening spill file: %w", err)
+	}
+
+	log.Info("spilling events to disk", "file", path)
+
+	return &spillFile{
+		path:   path,
+		writer: writer,
+		reader: reader,
+		buffer: bufio.NewReader(reader),
+		size:   int64(complete),
+		count:  bytes.Count(data[:complete], []byte{'\n'}),
+	}, nil
+}
+
+func (s *spillFile) write(data []byte) error {
+	if _, err := s.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	s.size += int64(len(data)) + 1
+	s.count++
+
+	return nil
+}
+
+func (s *spillFile) read() ([]byte, error) {
+	line, err := s.buffer.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	s.count--
+
+	if s.count == 0 {
+		s.reset()
+	}
+
+	return line, nil
+}
+
+func (s *spillFile) reset() {
+	s.count = 0
+	s.size = 0
+
+	if err := s.writer.Truncate(0); err != nil {
+		log.Warn("error truncating spill file", "error", err)
+	}
+
+	if _, err := s.reader.Seek(0, io.SeekStart); err != nil {
+		log.Warn("error rewinding spill file", "error", err)
+	}
+
+	s.buffer.Reset(s.reader)
+}
+
+// keep replaces the file with front followed by the lines not read yet and
+// closes it, a crash leaves either the old or the new file.
+func (s *spillFile) keep(front []byte) error {
+	defer s.reader.Close()
+	defer s.writer.Close()
+
+	rest, err := io.ReadAll(s.buffer)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.OpenFile(s.path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(append(front, rest...)); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(s.path+".tmp", s.path)
+}
+
+func (s *spillFile) close() error {
+	s.reader.Close()
+	s.writer.Close()
+
+	return os.Remove(s.path)
+}
@@ -0,0 +1,222 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fill queues events on a closed channel.
+func fill(events ...int) chan Message[int] {
+	in := make(chan Message[int], len(events))
+
+	for _, event := range events {
+		in <- Message[int]{Ctx: context.Background(), Event: event}
+	}
+
+	return in
+}
+
+// waitTaken waits until the queue received every message on in. Nothing reads
+// out meanwhile, so the overflow policy alone decides what is kept.
+func waitTaken(t *testing.T, in chan Message[int]) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+
+	for len(in) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("queue did not take %d events", len(in))
+		}
+
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func collect(out <-chan Message[int]) []int {
+	var events []int
+
+	for msg := range out {
+		events = append(events, msg.Event)
+	}
+
+	return events
+}
+
+func TestQueueOverflow(t *testing.T) {
+	tests := []struct {
+		overflow Overflow
+		want     []int
+	}{
+		{OverflowBlock, []int{1, 2, 3, 4, 5, 6}},
+		{OverflowDropOldest, []int{4, 5, 6}},
+		{OverflowDropNewest, []int{1, 2, 3}},
+		{OverflowSpill, []int{1, 2, 3, 4, 5, 6}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.overflow), func(t *testing.T) {
+			dir := t.TempDir()
+
+			q := NewQueue[int]("test", QueueConfig{
+				Size:          3,
+				Overflow:      tt.overflow,
+				SpillDir:      dir,
+				SpillMaxBytes: 1 << 20,
+			})
+
+			var wg sync.WaitGroup
+
+			in := fill(1, 2, 3, 4, 5, 6)
+			out := make(chan Message[int])
+
+			wg.Add(1)
+
+			go q.Run(context.Background(), in, out, &wg)
+
+			// a blocking queue stops taking events once full
+			if tt.overflow != OverflowBlock {
+				waitTaken(t, in)
+			}
+
+			close(in)
+
+			got := collect(out)
+			wg.Wait()
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+
+			if _, err := os.Stat(spillPath(dir, "test")); !os.IsNotExist(err) {
+				t.Errorf("spill file left after delivering everything: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueueSpillLimit(t *testing.T) {
+	q := NewQueue[int]("test", QueueConfig{
+		Size:     1,
+		Overflow: OverflowSpill,
+		SpillDir: t.TempDir(),
+		// room for two spilled events of one digit
+		SpillMaxBytes: 4,
+	})
+
+	var wg sync.WaitGroup
+
+	in := fill(1, 2, 3, 4, 5)
+	out := make(chan Message[int])
+
+	wg.Add(1)
+
+	go q.Run(context.Background(), in, out, &wg)
+
+	waitTaken(t, in)
+	close(in)
+
+	got := collect(out)
+	wg.Wait()
+
+	if want := []int{1, 2, 3}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestQueueKeepsSpillOnStop(t *testing.T) {
+	dir := t.TempDir()
+	config := QueueConfig{Size: 2, Overflow: OverflowSpill, SpillDir: dir, SpillMaxBytes: 1 << 20}
+
+	var wg sync.WaitGroup
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	in := make(chan Message[int], 5)
+	for event := 1; event <= 5; event++ {
+		in <- Message[int]{Ctx: context.Background(), Event: event}
+	}
+
+	out := make(chan Message[int])
+
+	wg.Add(1)
+
+	go NewQueue[int]("test", config).Run(ctx, in, out, &wg)
+
+	waitTaken(t, in)
+	cancel()
+	close(in)
+
+	if got := collect(out); len(got) != 0 {
+		t.Fatalf("delivered %v after being stopped", got)
+	}
+
+	wg.Wait()
+
+	in = fill(6)
+	close(in)
+
+	out = make(chan Message[int])
+
+	wg.Add(1)
+
+	go NewQueue[int]("test", config).Run(context.Background(), in, out, &wg)
+
+	got := collect(out)
+	wg.Wait()
+
+	if want := []int{1, 2, 3, 4, 5, 6}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("delivered %v after the restart, want %v", got, want)
+	}
+}
+
+func TestQueueRestoresSpill(t *testing.T) {
+	tests := []struct {
+		name  string
+		spill string
+		want  []int
+	}{
+		{"complete", "1\n2\n3\n", []int{1, 2, 3}},
+		{"torn last line", "1\n2\n3", []int{1, 2}},
+		{"undecodable line", "1\nx\n3\n", []int{1, 3}},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			if err := os.WriteFile(spillPath(dir, "test"), []byte(tt.spill), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			q := NewQueue[int]("test", QueueConfig{
+				Size:          1,
+				Overflow:      OverflowSpill,
+				SpillDir:      dir,
+				SpillMaxBytes: 1 << 20,
+			})
+
+			var wg sync.WaitGroup
+
+			in := fill()
+			close(in)
+
+			out := make(chan Message[int])
+
+			wg.Add(1)
+
+			go q.Run(context.Background(), in, out, &wg)
+
+			got := collect(out)
+			wg.Wait()
+
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("delivered %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
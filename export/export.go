@@ -0,0 +1,329 @@
+package export
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+	parquetgzip "github.com/parquet-go/parquet-go/compress/gzip"
+	parquetzstd "github.com/parquet-go/parquet-go/compress/zstd"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+const (
+	FormatNDJSON  = "ndjson"
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+
+	PartitionNone = "none"
+	PartitionHour = "hour"
+	PartitionDay  = "day"
+)
+
+var partitionLayouts = map[string]string{
+	PartitionHour: "2006-01-02T15",
+	PartitionDay:  "2006-01-02",
+}
+
+type Options struct {
+	Format      string
+	Compression string
+	Partition   string
+	// Out is the output file, or the directory files are written to when
+	// partitioning. Without partitioning an empty Out writes to Stdout.
+	Out    string
+	Prefix string
+	Stdout io.Writer
+}
+
+type rowWriter interface {
+	write(change *models.WikiRecentChanges) error
+	close() error
+}
+
+type output struct {
+	rows   rowWriter
+	closer []io.Closer
+}
+
+// Exporter writes changes in the chosen format, opening a new file each time
+// a change falls into the next time partition. Changes are expected in
+// timestamp order.
+type Exporter struct {
+	opts    Options
+	current *output
+	key     string
+	done    map[string]bool
+	written int64
+}
+
+func New(opts Options) (*Exporter, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "wiki_changes"
+	}
+
+	switch opts.Format {
+	case FormatNDJSON, FormatCSV, FormatParquet:
+	default:
+		return nil, fmt.Errorf("unknown format %q", opts.Format)
+	}
+
+	switch opts.Compression {
+	case CompressionNone, CompressionGzip, CompressionZstd:
+	default:
+		return nil, fmt.Errorf("unknown compression %q", opts.Compression)
+	}
+
+	if _, ok := partitionLayouts[opts.Partition]; !ok && opts.Partition != PartitionNone {
+		return nil, fmt.Errorf("unknown partition %q", opts.Partition)
+	}
+
+	if opts.Partition != PartitionNone {
+		if opts.Out == "" {
+			return nil, fmt.Errorf("partitioned export needs an output directory")
+		}
+
+		if err := os.MkdirAll(opts.Out, 0o750); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Exporter{
+		opts: opts,
+		done: make(map[string]bool),
+	}, nil
+}
+
+func (e *Exporter) Written() int64 {
+	return e.written
+}
+
+func (e *Exporter) Write(change *models.WikiRecentChanges) error {
+	key := ""
+	if layout, ok := partitionLayouts[e.opts.Partition]; ok {
+		key = change.Time().Format(layout)
+	}
+
+	if e.current == nil || key != e.key {
+		if e.done[key] {
+			return fmt.Errorf("change %s is out of timestamp order", change.Meta.ID)
+		}
+
+		if err := e.closeCurrent(); err != nil {
+			return err
+		}
+
+		current, err := e.open(key)
+		if err != nil {
+			return err
+		}
+
+		e.current = current
+		e.key = key
+	}
+
+	if err := e.current.rows.write(change); err != nil {
+		return err
+	}
+
+	e.written++
+
+	return nil
+}
+
+func (e *Exporter) Close() error {
+	return e.closeCurrent()
+}
+
+func (e *Exporter) closeCurrent() error {
+	if e.current == nil {
+		return nil
+	}
+
+	e.done[e.key] = true
+
+	err := e.current.rows.close()
+
+	for i := len(e.current.closer) - 1; i >= 0; i-- {
+		if closeErr := e.current.closer[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+
+	e.current = nil
+
+	return err
+}
+
+func (e *Exporter) open(key string) (*output, error) {
+	var (
+		w   io.Writer = e.opts.Stdout
+		out           = &output{}
+	)
+
+	if path := e.path(key); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+
+		w = file
+		out.closer = append(out.closer, file)
+	}
+
+	// parquet compresses its own pages, so only the row based formats are
+	// wrapped in a compressed stream
+	if e.opts.Format != FormatParquet {
+		switch e.opts.Compression {
+		case CompressionGzip:
+			gz := gzip.NewWriter(w)
+			w = gz
+			out.closer = append(out.closer, gz)
+		case CompressionZstd:
+			zw, err := zstd.NewWriter(w)
+			if err != nil {
+				return nil, err
+			}
+
+			w = zw
+			out.closer = append(out.closer, zw)
+		}
+	}
+
+	switch e.opts.Format {
+	case FormatCSV:
+		out.rows = newCSVWriter(w)
+	case FormatParquet:
+		out.rows = newParquetWriter(w, e.opts.Compression)
+	default:
+		out.rows = newNDJSONWriter(w)
+	}
+
+	return out, nil
+}
+
+func (e *Exporter) path(key string) string {
+	if e.opts.Partition == PartitionNone {
+		return e.opts.Out
+	}
+
+	name := fmt.Sprintf("%s-%s.%s", e.opts.Prefix, key, e.opts.Format)
+
+	switch {
+	case e.opts.Format == FormatParquet:
+	case e.opts.Compression == CompressionGzip:
+		name += ".gz"
+	case e.opts.Compression == CompressionZstd:
+		name += ".zst"
+	}
+
+	return filepath.Join(e.opts.Out, name)
+}
+
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func newNDJSONWriter(w io.Writer) *ndjsonWriter {
+	buffered := bufio.NewWriter(w)
+
+	return &ndjsonWriter{
+		buffered: buffered,
+		encoder:  json.NewEncoder(buffered),
+	}
+}
+
+func (n *ndjsonWriter) write(change *models.WikiRecentChanges) error {
+	return n.encoder.Encode(change)
+}
+
+func (n *ndjsonWriter) close() error {
+	return n.buffered.Flush()
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func newCSVWriter(w io.Writer) *csvWriter {
+	return &csvWriter{
+		writer: csv.NewWriter(w),
+	}
+}
+
+func (c *csvWriter) write(change *models.WikiRecentChanges) error {
+	if !c.header {
+		if err := c.writer.Write(csvHeader); err != nil {
+			return err
+		}
+
+		c.header = true
+	}
+
+	return c.writer.Write(NewRow(change).record())
+}
+
+func (c *csvWriter) close() error {
+	c.writer.Flush()
+
+	return c.writer.Error()
+}
+
+type parquetWriter struct {
+	writer *parquet.GenericWriter[Row]
+	rows   []Row
+}
+
+func newParquetWriter(w io.Writer, compression string) *parquetWriter {
+	var options []parquet.WriterOption
+
+	switch compression {
+	case CompressionGzip:
+		options = append(options, parquet.Compression(&parquetgzip.Codec{}))
+	case CompressionZstd:
+		options = append(options, parquet.Compression(&parquetzstd.Codec{}))
+	}
+
+	return &parquetWriter{
+		writer: parquet.NewGenericWriter[Row](w, options...),
+	}
+}
+
+func (p *parquetWriter) write(change *models.WikiRecentChanges) error {
+	p.rows = append(p.rows, NewRow(change))
+
+	if len(p.rows) < 1000 {
+		return nil
+	}
+
+	return p.flush()
+}
+
+func (p *parquetWriter) flush() error {
+	_, err := p.writer.Write(p.rows)
+	p.rows = p.rows[:0]
+
+	return err
+}
+
+func (p *parquetWriter) close() error {
+	if err := p.flush(); err != nil {
+		return err
+	}
+
+	return p.writer.Close()
+}
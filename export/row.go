@@ -0,0 +1,110 @@
+package export
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+// Row is the flat shape of a change used by the CSV and Parquet formats.
+type Row struct {
+	MetaID           string    `parquet:"meta_id"`
+	MetaDt           time.Time `parquet:"meta_dt,timestamp(millisecond)"`
+	ID               int64     `parquet:"id"`
+	Type             string    `parquet:"type,dict"`
+	Namespace        int32     `parquet:"namespace"`
+	Title            string    `parquet:"title"`
+	TitleURL         string    `parquet:"title_url"`
+	Comment          string    `parquet:"comment"`
+	Timestamp        int64     `parquet:"timestamp"`
+	User             string    `parquet:"user"`
+	Bot              bool      `parquet:"bot"`
+	Minor            bool      `parquet:"minor"`
+	Patrolled        bool      `parquet:"patrolled"`
+	LengthOld        int32     `parquet:"length_old"`
+	LengthNew        int32     `parquet:"length_new"`
+	RevisionOld      int64     `parquet:"revision_old"`
+	RevisionNew      int64     `parquet:"revision_new"`
+	ServerName       string    `parquet:"server_name,dict"`
+	ServerPrefix     string    `parquet:"server_prefix,dict"`
+	Language         string    `parquet:"language,dict"`
+	Project          string    `parquet:"project,dict"`
+	Wiki             string    `parquet:"wiki,dict"`
+	LogID            int64     `parquet:"log_id"`
+	LogType          string    `parquet:"log_type,dict"`
+	LogAction        string    `parquet:"log_action,dict"`
+	LogParams        string    `parquet:"log_params"`
+	LogActionComment string    `parquet:"log_action_comment"`
+}
+
+var csvHeader = []string{
+	"meta_id", "meta_dt", "id", "type", "namespace", "title", "title_url", "comment",
+	"timestamp", "user", "bot", "minor", "patrolled", "length_old", "length_new",
+	"revision_old", "revision_new", "server_name", "server_prefix", "language", "project", "wiki",
+	"log_id", "log_type", "log_action", "log_params", "log_action_comment",
+}
+
+func NewRow(change *models.WikiRecentChanges) Row {
+	return Row{
+		MetaID:           change.Meta.ID,
+		MetaDt:           change.Meta.Dt,
+		ID:               change.ID,
+		Type:             change.Type,
+		Namespace:        int32(change.Namespace),
+		Title:            change.Title,
+		TitleURL:         change.TitleURL,
+		Comment:          change.Comment,
+		Timestamp:        int64(change.Timestamp),
+		User:             change.User,
+		Bot:              change.Bot,
+		Minor:            change.Minor,
+		Patrolled:        change.Patrolled,
+		LengthOld:        int32(change.Length.Old),
+		LengthNew:        int32(change.Length.New),
+		RevisionOld:      change.Revision.Old,
+		RevisionNew:      change.Revision.New,
+		ServerName:       change.ServerName,
+		ServerPrefix:     change.ServerPrefix,
+		Language:         change.Language,
+		Project:          change.Project,
+		Wiki:             change.Wiki,
+		LogID:            change.LogID,
+		LogType:          change.LogType,
+		LogAction:        change.LogAction,
+		LogParams:        change.LogParams.String(),
+		LogActionComment: change.LogActionComment,
+	}
+}
+
+func (r Row) record() []string {
+	return []string{
+		r.MetaID,
+		r.MetaDt.Format(time.RFC3339),
+		strconv.FormatInt(r.ID, 10),
+		r.Type,
+		strconv.Itoa(int(r.Namespace)),
+		r.Title,
+		r.TitleURL,
+		r.Comment,
+		strconv.FormatInt(r.Timestamp, 10),
+		r.User,
+		strconv.FormatBool(r.Bot),
+		strconv.FormatBool(r.Minor),
+		strconv.FormatBool(r.Patrolled),
+		strconv.Itoa(int(r.LengthOld)),
+		strconv.Itoa(int(r.LengthNew)),
+		strconv.FormatInt(r.RevisionOld, 10),
+		strconv.FormatInt(r.RevisionNew, 10),
+		r.ServerName,
+		r.ServerPrefix,
+		r.Language,
+		r.Project,
+		r.Wiki,
+		strconv.FormatInt(r.LogID, 10),
+		r.LogType,
+		r.LogAction,
+		r.LogParams,
+		r.LogActionComment,
+	}
+}
@@ -0,0 +1,69 @@
+package filter
+
+import (
+	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+// Filter decides which changes get ingested. Wikis match either the server
+// name (en.wikipedia.org) or the database name (enwiki), empty lists allow
+// everything.
+type Filter struct {
+	wikis        map[string]bool
+	excludeWikis map[string]bool
+	types        map[string]bool
+	namespaces   map[int]bool
+	excludeBots  bool
+}
+
+func New(cfg config.FilterConfig) *Filter {
+	f := &Filter{
+		wikis:        make(map[string]bool),
+		excludeWikis: make(map[string]bool),
+		types:        make(map[string]bool),
+		namespaces:   make(map[int]bool),
+		excludeBots:  cfg.ExcludeBots,
+	}
+
+	for _, wiki := range cfg.Wikis {
+		f.wikis[wiki] = true
+	}
+
+	for _, wiki := range cfg.ExcludeWikis {
+		f.excludeWikis[wiki] = true
+	}
+
+	for _, t := range cfg.Types {
+		f.types[t] = true
+	}
+
+	for _, namespace := range cfg.Namespaces {
+		f.namespaces[namespace] = true
+	}
+
+	return f
+}
+
+func (f *Filter) Allow(e models.WikiRecentChanges) bool {
+	if f.excludeBots && e.Bot {
+		return false
+	}
+
+	if f.excludeWikis[e.ServerName] || f.excludeWikis[e.Wiki] {
+		return false
+	}
+
+	if len(f.wikis) > 0 && !f.wikis[e.ServerName] && !f.wikis[e.Wiki] {
+		return false
+	}
+
+	if len(f.types) > 0 && !f.types[e.Type] {
+		return false
+	}
+
+	if len(f.namespaces) > 0 && !f.namespaces[e.Namespace] {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,390 @@
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pipeline"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+	"github.com/Sanjar0126/wiki_change_stream/storage"
+)
+
+var log = logger.For("import")
+
+const checkpointSuffix = ".import-checkpoint"
+
+type Options struct {
+	Workers          int
+	BatchSize        int
+	Resume           bool
+	ProgressInterval time.Duration
+	Decode           func(data []byte) (models.WikiRecentChanges, error)
+	OnReject         func(ctx context.Context, data []byte, err error)
+}
+
+type Progress struct {
+	Offset   int64 `json:"offset"`
+	Read     int64 `json:"read"`
+	Inserted int64 `json:"inserted"`
+	Skipped  int64 `json:"skipped"`
+	Rejected int64 `json:"rejected"`
+}
+
+type rejected struct {
+	data []byte
+	err  error
+}
+
+// batch holds the lines read up to end, they are counted and their rejects
+// handed to OnReject only once the checkpoint passes them, so a resumed
+// import does not repeat them.
+type batch struct {
+	seq      int64
+	end      int64
+	read     int64
+	changes  []models.WikiRecentChanges
+	rejected []rejected
+}
+
+type finished struct {
+	batch
+	inserted int
+	skipped  int
+}
+
+// Importer bulk loads NDJSON or recorded SSE archives into storage. Changes
+// already stored under the same meta.id are skipped, and the offset of the
+// last fully written batch is checkpointed next to the file so an
+// interrupted import resumes where it stopped.
+type Importer struct {
+	db   storage.StorageI
+	opts Options
+
+	mu       sync.Mutex
+	progress Progress
+	pending  map[int64]finished
+	next     int64
+}
+
+func New(db storage.StorageI, opts Options) *Importer {
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 500
+	}
+
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = 10 * time.Second
+	}
+
+	return &Importer{
+		db:   db,
+		opts: opts,
+	}
+}
+
+func (im *Importer) Import(ctx context.Context, path string) (Progress, error) {
+	im.progress = Progress{}
+	im.pending = make(map[int64]finished)
+	im.next = 0
+
+	if im.opts.Resume {
+		progress, err := readCheckpoint(path)
+		if err != nil {
+			return im.progress, err
+		}
+
+		if progress.Offset > 0 {
+			log.Info("resuming import", "file", path, "offset", progress.Offset)
+		}
+
+		im.progress = progress
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return im.progress, err
+	}
+	defer file.Close()
+
+	reader, err := decompress(path, file)
+	if err != nil {
+		return im.progress, err
+	}
+
+	if _, err := io.CopyN(io.Discard, reader, im.progress.Offset); err != nil {
+		return im.progress, fmt.Errorf("error skipping to checkpoint: %w", err)
+	}
+
+	var (
+		wg      sync.WaitGroup
+		batches = make(chan batch, im.opts.Workers)
+		errs    = make(chan error, im.opts.Workers)
+	)
+
+	workerCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for i := 0; i < im.opts.Workers; i++ {
+		wg.Add(1)
+
+		go im.worker(workerCtx, cancel, path, batches, errs, &wg)
+	}
+
+	done := make(chan struct{})
+	go im.report(path, done)
+
+	readErr := im.read(workerCtx, reader, batches)
+
+	close(batches)
+	wg.Wait()
+	close(done)
+
+	select {
+	case err = <-errs:
+	default:
+		err = readErr
+	}
+
+	if err == nil {
+		err = ctx.Err()
+	}
+
+	if err == nil {
+		err = os.Remove(path + checkpointSuffix)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		}
+	}
+
+	return im.snapshot(), err
+}
+
+func (im *Importer) read(ctx context.Context, r io.Reader, batches chan<- batch) error {
+	var (
+		reader  = bufio.NewReaderSize(r, 64*1024)
+		offset  = im.progress.Offset
+		current = batch{}
+		seq     int64
+	)
+
+	send := func() bool {
+		current.seq = seq
+		current.end = offset
+		seq++
+
+		select {
+		case batches <- current:
+			current = batch{}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		offset += int64(len(line))
+
+		if data := payload(line); data != nil {
+			im.add(&current, data)
+		}
+
+		if len(current.changes)+len(current.rejected) >= im.opts.BatchSize || err != nil {
+			if !send() {
+				return ctx.Err()
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("error reading: %w", err)
+		}
+	}
+}
+
+func (im *Importer) add(current *batch, data []byte) {
+	current.read++
+
+	change, err := im.opts.Decode(data)
+	if err != nil {
+		current.rejected = append(current.rejected, rejected{data: data, err: err})
+		return
+	}
+
+	pipeline.Enrich(&change)
+
+	current.changes = append(current.changes, change)
+}
+
+func (im *Importer) worker(ctx context.Context, cancel context.CancelFunc, path string,
+	batches <-chan batch, errs chan<- error, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for b := range batches {
+		inserted, skipped, err := im.db.WikiChanges().CreateMany(ctx, b.changes)
+		if err != nil {
+			select {
+			case errs <- err:
+			default:
+			}
+
+			// stops the reader and the other workers, the checkpoint stays
+			// at the last batch written without a gap
+			cancel()
+
+			return
+		}
+
+		im.commit(ctx, path, finished{batch: b, inserted: inserted, skipped: skipped})
+	}
+}
+
+// commit records a written batch and moves the checkpoint forward over every
+// batch written without a gap, since workers complete them out of order. The
+// checkpoint only counts the lines before its offset, and their rejects are
+// handed to OnReject just before it is written.
+func (im *Importer) commit(ctx context.Context, path string, f finished) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	f.changes = nil
+	im.pending[f.seq] = f
+
+	advanced := false
+
+	for {
+		f, ok := im.pending[im.next]
+		if !ok {
+			break
+		}
+
+		if im.opts.OnReject != nil {
+			for _, r := range f.rejected {
+				im.opts.OnReject(ctx, r.data, r.err)
+			}
+		}
+
+		delete(im.pending, im.next)
+		im.progress.Offset = f.end
+		im.progress.Read += f.read
+		im.progress.Inserted += int64(f.inserted)
+		im.progress.Skipped += int64(f.skipped)
+		im.progress.Rejected += int64(len(f.rejected))
+		im.next++
+		advanced = true
+	}
+
+	if advanced {
+		if err := writeCheckpoint(path, im.progress); err != nil {
+			log.Error("error writing checkpoint", "file", path, "error", err)
+		}
+	}
+}
+
+func (im *Importer) report(path string, done <-chan struct{}) {
+	start := time.Now()
+
+	ticker := time.NewTicker(im.opts.ProgressInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			p := im.snapshot()
+			rate := float64(p.Inserted+p.Skipped) / time.Since(start).Seconds()
+
+			log.Info("import progress", "file", path, "read", p.Read, "inserted", p.Inserted,
+				"skipped", p.Skipped, "rejected", p.Rejected, "rate", math.Round(rate))
+		}
+	}
+}
+
+func (im *Importer) snapshot() Progress {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.progress
+}
+
+// payload returns the JSON of an NDJSON line or an SSE "data: " line.
+func payload(line string) []byte {
+	line = strings.TrimSpace(line)
+
+	if data, ok := strings.CutPrefix(line, "data: "); ok {
+		return []byte(data)
+	}
+
+	if strings.HasPrefix(line, "{") {
+		return []byte(line)
+	}
+
+	return nil
+}
+
+func decompress(path string, r io.Reader) (io.Reader, error) {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return gzip.NewReader(r)
+	case strings.HasSuffix(path, ".zst"):
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	default:
+		return r, nil
+	}
+}
+
+func readCheckpoint(path string) (Progress, error) {
+	var progress Progress
+
+	data, err := os.ReadFile(path + checkpointSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		return progress, nil
+	}
+
+	if err != nil {
+		return progress, err
+	}
+
+	err = json.Unmarshal(data, &progress)
+
+	return progress, err
+}
+
+func writeCheckpoint(path string, progress Progress) error {
+	data, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + checkpointSuffix + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path+checkpointSuffix)
+}
@@ -0,0 +1,107 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// written is batch seq as a worker finishes it: three lines ending at
+// (seq+1)*100, one inserted, one skipped and one rejected.
+func written(seq int64) finished {
+	return finished{
+		batch: batch{
+			seq:      seq,
+			end:      (seq + 1) * 100,
+			read:     3,
+			rejected: []rejected{{data: []byte(fmt.Sprint(seq)), err: errors.New("bad line")}},
+		},
+		inserted: 1,
+		skipped:  1,
+	}
+}
+
+func TestCommitOutOfOrder(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   []int64
+		offsets []int64
+		rejects []string
+	}{
+		{"in order", []int64{0, 1, 2}, []int64{100, 200, 300}, []string{"0", "1", "2"}},
+		{"second first", []int64{1, 0, 2}, []int64{0, 200, 300}, []string{"0", "1", "2"}},
+		{"reversed", []int64{2, 1, 0}, []int64{0, 0, 300}, []string{"0", "1", "2"}},
+		{"first missing", []int64{1, 2}, []int64{0, 0}, nil},
+		{"gap", []int64{0, 2}, []int64{100, 100}, []string{"0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rejects []string
+
+			path := filepath.Join(t.TempDir(), "changes.ndjson")
+
+			im := New(nil, Options{OnReject: func(_ context.Context, data []byte, _ error) {
+				rejects = append(rejects, string(data))
+			}})
+			im.pending = make(map[int64]finished)
+
+			for i, seq := range tt.order {
+				im.commit(context.Background(), path, written(seq))
+
+				want := tt.offsets[i]
+				batches := want / 100
+
+				wantProgress := Progress{
+					Offset:   want,
+					Read:     3 * batches,
+					Inserted: batches,
+					Skipped:  batches,
+					Rejected: batches,
+				}
+
+				if got := im.snapshot(); got != wantProgress {
+					t.Fatalf("progress after batch %d = %+v, want %+v", seq, got, wantProgress)
+				}
+
+				checkpoint, err := readCheckpoint(path)
+				if err != nil {
+					t.Fatalf("readCheckpoint: %v", err)
+				}
+
+				if checkpoint != wantProgress {
+					t.Fatalf("checkpoint after batch %d = %+v, want %+v", seq, checkpoint, wantProgress)
+				}
+			}
+
+			if fmt.Sprint(rejects) != fmt.Sprint(tt.rejects) {
+				t.Errorf("rejects handed over %v, want %v", rejects, tt.rejects)
+			}
+		})
+	}
+}
+
+func TestPayload(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`{"id":1}` + "\n", `{"id":1}`},
+		{`  {"id":1}  `, `{"id":1}`},
+		{`data: {"id":1}` + "\n", `{"id":1}`},
+		{"event: message\n", ""},
+		{"id: [{\"offset\":1}]\n", ""},
+		{":ok\n", ""},
+		{"\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := string(payload(tt.line)); got != tt.want {
+				t.Errorf("payload(%q) = %q, want %q", tt.line, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type EditWarIncident struct {
+	BId        primitive.ObjectID `json:"_id" bson:"_id"` //nolint
+	Wiki       string             `json:"wiki" bson:"wiki"`
+	Title      string             `json:"title" bson:"title"`
+	TitleURL   string             `json:"title_url" bson:"title_url"`
+	Users      []string           `json:"users" bson:"users"`
+	Reverts    int                `json:"reverts" bson:"reverts"`
+	Revisions  []int64            `json:"revisions" bson:"revisions"`
+	StartedAt  time.Time          `json:"started_at" bson:"started_at"`
+	DetectedAt time.Time          `json:"detected_at" bson:"detected_at"`
+}
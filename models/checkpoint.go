@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Checkpoint records the last event a consumer finished processing, so it
+// can continue from there after a restart.
+type Checkpoint struct {
+	Name      string    `json:"name" bson:"_id"`
+	Dt        time.Time `json:"dt" bson:"dt"`
+	MetaID    string    `json:"meta_id" bson:"meta_id"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
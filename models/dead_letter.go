@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type DeadLetter struct {
+	BId       primitive.ObjectID `json:"_id" bson:"_id"` //nolint
+	Data      string             `json:"data" bson:"data"`
+	Error     string             `json:"error" bson:"error"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
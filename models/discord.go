@@ -1,9 +1,61 @@
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type DiscordUser struct {
 	BId      primitive.ObjectID `json:"_id" bson:"_id"` //nolint
 	AuthorId string             `json:"author_id" bson:"author_id"`
 	Lang     string             `json:"lang" bson:"lang"`
+	Project  string             `json:"project" bson:"project"`
+	// Languages are all languages the user follows, Lang and Project hold
+	// the first one.
+	Languages []WikiLanguage `json:"languages,omitempty" bson:"languages,omitempty"`
+	// Digest is nil for users who get no digest.
+	Digest *Digest `json:"digest,omitempty" bson:"digest,omitempty"`
+}
+
+// Digest frequencies, weekly digests are sent on Mondays.
+const (
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// Digest is when a user gets the summary of their languages by direct
+// message.
+type Digest struct {
+	Frequency string `json:"frequency" bson:"frequency"`
+	// Time is the time of day as HH:MM in Timezone, an IANA zone name.
+	Time     string `json:"time" bson:"time"`
+	Timezone string `json:"timezone" bson:"timezone"`
+	// SentFor is the scheduled time of the last digest sent.
+	SentFor time.Time `json:"sent_for" bson:"sent_for"`
+}
+
+// WikiLanguage is a language prefix in a project family, an empty project
+// stands for every project.
+type WikiLanguage struct {
+	Lang    string `json:"lang" bson:"lang"`
+	Project string `json:"project" bson:"project"`
+}
+
+// Wikis returns the languages the user follows, the first one is the default
+// of commands taking a single wiki.
+func (u *DiscordUser) Wikis() []WikiLanguage {
+	if len(u.Languages) > 0 {
+		return u.Languages
+	}
+
+	return []WikiLanguage{{Lang: u.Lang, Project: u.Project}}
+}
+
+type DiscordSubscription struct {
+	BId       primitive.ObjectID `json:"_id" bson:"_id"` //nolint
+	ChannelID string             `json:"channel_id" bson:"channel_id"`
+	AuthorId  string             `json:"author_id" bson:"author_id"`
+	Topic     string             `json:"topic" bson:"topic"`
+	Wiki      string             `json:"wiki" bson:"wiki"`
 }
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Features a guild can turn off, they are on unless disabled.
+const (
+	FeatureRecent        = "recent"
+	FeatureStats         = "stats"
+	FeatureTrending      = "trending"
+	FeatureLookup        = "lookup"
+	FeatureSubscriptions = "subscriptions"
+)
+
+var GuildFeatures = []string{
+	FeatureRecent, FeatureStats, FeatureTrending, FeatureLookup, FeatureSubscriptions,
+}
+
+// DiscordGuild holds the settings of a server the bot was added to. The zero
+// value stands for the defaults, and for direct messages.
+type DiscordGuild struct {
+	GuildID string `json:"guild_id" bson:"_id"`
+	// Lang and Project are used by members who did not pick languages.
+	Lang    string `json:"lang" bson:"lang"`
+	Project string `json:"project" bson:"project"`
+	// AllowedChannels limits the channels the bot answers in, every channel
+	// when empty.
+	AllowedChannels []string `json:"allowed_channels" bson:"allowed_channels"`
+	CommandPrefix   string   `json:"command_prefix" bson:"command_prefix"`
+	// AdminRole may change the settings besides members allowed to manage
+	// the server.
+	AdminRole string          `json:"admin_role" bson:"admin_role"`
+	Disabled  map[string]bool `json:"disabled" bson:"disabled"`
+	// Welcome sends new members a direct message introducing the commands.
+	Welcome   bool      `json:"welcome" bson:"welcome"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+func (g *DiscordGuild) Enabled(feature string) bool {
+	return feature == "" || !g.Disabled[feature]
+}
+
+func (g *DiscordGuild) AllowsChannel(channelID string) bool {
+	return len(g.AllowedChannels) == 0 || slices.Contains(g.AllowedChannels, channelID)
+}
+
+// Prefix returns the command prefix of the guild, fallback when it has none.
+func (g *DiscordGuild) Prefix(fallback string) string {
+	if g.CommandPrefix != "" {
+		return g.CommandPrefix
+	}
+
+	return fallback
+}
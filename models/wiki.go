@@ -1,6 +1,9 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -15,17 +18,27 @@ type WikiRecentChangesMeta struct {
 	Stream    string    `json:"stream" bson:"stream"`
 	Topic     string    `json:"topic" bson:"topic"`
 	Partition int       `json:"partition" bson:"partition"`
-	Offset    int       `json:"offset" bson:"offset"`
+	Offset    int64     `json:"offset" bson:"offset"`
 }
 
 type WikiRecentChangesLength struct {
+	Old int `json:"old" bson:"old"`
 	New int `json:"new" bson:"new"`
 }
 
 type Revision struct {
+	Old int64 `json:"old" bson:"old"`
 	New int64 `json:"new" bson:"new"`
 }
 
+// LogParams holds the log_params property, which upstream sends as an
+// object, an array or a plain string depending on the log type.
+type LogParams struct {
+	Values map[string]interface{} `json:"-" bson:"values,omitempty"`
+	List   []interface{}          `json:"-" bson:"list,omitempty"`
+	Text   string                 `json:"-" bson:"text,omitempty"`
+}
+
 type WikiRecentChanges struct {
 	BId              primitive.ObjectID      `json:"_id" bson:"_id"`         //nolint
 	Schema           string                  `json:"$schema" bson:"$schema"` //nolint
@@ -43,11 +56,159 @@ type WikiRecentChanges struct {
 	Minor            bool                    `json:"minor" bson:"minor"`
 	Patrolled        bool                    `json:"patrolled" bson:"patrolled"`
 	Length           WikiRecentChangesLength `json:"length" bson:"length"`
+	LengthDelta      int                     `json:"length_delta" bson:"length_delta"`
 	Revision         Revision                `json:"revision" bson:"revision"`
 	ServerURL        string                  `json:"server_url" bson:"server_url"`
 	ServerName       string                  `json:"server_name" bson:"server_name"`
 	ServerPrefix     string                  `json:"server_prefix" bson:"server_prefix"`
+	Language         string                  `json:"language,omitempty" bson:"language,omitempty"`
+	Project          string                  `json:"project" bson:"project"`
+	Special          bool                    `json:"special" bson:"special"`
 	ServerScriptPath string                  `json:"server_script_path" bson:"server_script_path"`
 	Wiki             string                  `json:"wiki" bson:"wiki"`
 	Parsedcomment    string                  `json:"parsedcomment" bson:"parsedcomment"`
+	LogID            int64                   `json:"log_id,omitempty" bson:"log_id,omitempty"`
+	LogType          string                  `json:"log_type,omitempty" bson:"log_type,omitempty"`
+	LogAction        string                  `json:"log_action,omitempty" bson:"log_action,omitempty"`
+	LogParams        *LogParams              `json:"log_params,omitempty" bson:"log_params,omitempty"`
+	LogActionComment string                  `json:"log_action_comment,omitempty" bson:"log_action_comment,omitempty"`
+}
+
+type WikiChangesFilter struct {
+	Lang    string
+	Project string
+	// Languages match changes in any of them.
+	Languages []WikiLanguage
+	Type      string
+	LogType   string
+	LogAction string
+	From      time.Time
+	To        time.Time
+	// Newest lists the newest changes first instead of the oldest.
+	Newest bool
+}
+
+// WikiSite counts the changes stored for a language or special wiki.
+type WikiSite struct {
+	Prefix  string `json:"prefix" bson:"prefix"`
+	Project string `json:"project" bson:"project"`
+	Changes int64  `json:"changes" bson:"changes"`
+}
+
+// WikiDigest summarizes the changes of a period.
+type WikiDigest struct {
+	Changes  int64 `json:"changes" bson:"changes"`
+	Edits    int64 `json:"edits" bson:"edits"`
+	NewPages int64 `json:"new_pages" bson:"new_pages"`
+	Logs     int64 `json:"logs" bson:"logs"`
+	Bots     int64 `json:"bots" bson:"bots"`
+	Users    int64 `json:"users" bson:"users"`
+	// TopPages are the most edited pages, Created the latest new articles.
+	TopPages   []WikiPageEdits `json:"top_pages" bson:"top_pages"`
+	Created    []WikiPageEdits `json:"created" bson:"created"`
+	LogActions []WikiLogCount  `json:"log_actions" bson:"log_actions"`
+}
+
+type WikiPageEdits struct {
+	ServerName string `json:"server_name" bson:"server_name"`
+	Title      string `json:"title" bson:"title"`
+	TitleURL   string `json:"title_url" bson:"title_url"`
+	Edits      int64  `json:"edits" bson:"edits"`
+}
+
+// WikiLogCount counts the log events of one type and action.
+type WikiLogCount struct {
+	LogType   string `json:"log_type" bson:"log_type"`
+	LogAction string `json:"log_action" bson:"log_action"`
+	Count     int64  `json:"count" bson:"count"`
+}
+
+func (w *WikiRecentChanges) ByteDelta() int {
+	return w.Length.New - w.Length.Old
+}
+
+func (w *WikiRecentChanges) Time() time.Time {
+	return time.Unix(int64(w.Timestamp), 0).UTC()
+}
+
+func (w *WikiRecentChanges) IsLog() bool {
+	return w.Type == "log"
+}
+
+// DiffURL links to the diff of an edit, the first revision of a new page or
+// the page itself for changes without a revision.
+func (w *WikiRecentChanges) DiffURL() string {
+	switch {
+	case w.Revision.New == 0 || w.ServerURL == "":
+		return w.TitleURL
+	case w.Revision.Old == 0:
+		return fmt.Sprintf("%s%s/index.php?oldid=%d", w.ServerURL, w.ServerScriptPath, w.Revision.New)
+	default:
+		return fmt.Sprintf("%s%s/index.php?diff=%d&oldid=%d",
+			w.ServerURL, w.ServerScriptPath, w.Revision.New, w.Revision.Old)
+	}
+}
+
+func (p *LogParams) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	switch data[0] {
+	case '{':
+		return json.Unmarshal(data, &p.Values)
+	case '[':
+		return json.Unmarshal(data, &p.List)
+	case '"':
+		return json.Unmarshal(data, &p.Text)
+	default:
+		return fmt.Errorf("unexpected log_params value: %s", data)
+	}
+}
+
+func (p LogParams) MarshalJSON() ([]byte, error) {
+	switch {
+	case p.Values != nil:
+		return json.Marshal(p.Values)
+	case p.List != nil:
+		return json.Marshal(p.List)
+	default:
+		return json.Marshal(p.Text)
+	}
+}
+
+// Get returns a named parameter, e.g. "target" for moves or "duration" for
+// blocks, formatted as a string.
+func (p *LogParams) Get(key string) string {
+	if p == nil || p.Values == nil {
+		return ""
+	}
+
+	value, ok := p.Values[key]
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprint(value)
+}
+
+// IsEmpty reports whether no parameters were sent, including an empty object
+// or array.
+func (p *LogParams) IsEmpty() bool {
+	return p == nil || len(p.Values) == 0 && len(p.List) == 0 && p.Text == ""
+}
+
+func (p *LogParams) String() string {
+	if p == nil {
+		return ""
+	}
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return ""
+	}
+
+	return string(data)
 }
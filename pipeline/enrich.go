@@ -0,0 +1,38 @@
+package pipeline
+
+import (
+	"context"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/wikisite"
+)
+
+// ServerPrefix sets the language and project family of the wiki, en and
+// wikipedia for en.m.wikipedia.org. The prefix of special wikis such as
+// commons.wikimedia.org is their name.
+var ServerPrefix = StageFunc[models.WikiRecentChanges](
+	func(_ context.Context, e *models.WikiRecentChanges) error {
+		site := wikisite.Parse(e.ServerName, e.Wiki)
+
+		e.ServerPrefix = site.Prefix()
+		e.Language = site.Language
+		e.Project = site.Project
+		e.Special = site.Special
+
+		return nil
+	})
+
+// LengthDelta stores the change in page size, so it can be queried on.
+var LengthDelta = StageFunc[models.WikiRecentChanges](
+	func(_ context.Context, e *models.WikiRecentChanges) error {
+		e.LengthDelta = e.ByteDelta()
+		return nil
+	})
+
+// Enrich applies every enricher, for commands storing changes without an
+// ingest pipeline.
+func Enrich(e *models.WikiRecentChanges) {
+	for _, stage := range []Stage[models.WikiRecentChanges]{ServerPrefix, LengthDelta} {
+		_ = stage.Process(context.Background(), e)
+	}
+}
@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/metrics"
+)
+
+// ErrSkip is returned by a stage to stop an event without an error, such as
+// a filter rejecting it. The stages after it do not see the event.
+var ErrSkip = errors.New("skipped")
+
+type ErrorPolicy string
+
+const (
+	// Continue logs the error and hands the event to the next stage.
+	Continue ErrorPolicy = "continue"
+	// Skip logs the error and stops the event.
+	Skip ErrorPolicy = "skip"
+	// Retry runs the stage again up to Retries times, then continues.
+	Retry ErrorPolicy = "retry"
+)
+
+var (
+	log   = logger.For("pipeline")
+	meter = metrics.Meter("pipeline")
+
+	stageEvents, _ = meter.Int64Counter("pipeline.stage.events",
+		metric.WithDescription("Events handled by a stage, by result"))
+	stageDuration, _ = meter.Float64Histogram("pipeline.stage.duration", metric.WithUnit("s"),
+		metric.WithDescription("Time a stage spent on one event"))
+)
+
+// Stage handles an event on its way through the pipeline. Filters return
+// ErrSkip, enrichers change the event in place and sinks hand it elsewhere.
+type Stage[T any] interface {
+	Process(ctx context.Context, e *T) error
+}
+
+// StageFunc adapts a function to a Stage.
+type StageFunc[T any] func(ctx context.Context, e *T) error
+
+func (f StageFunc[T]) Process(ctx context.Context, e *T) error {
+	return f(ctx, e)
+}
+
+// StageConfig places a stage in the pipeline along with what to do when it
+// fails.
+type StageConfig[T any] struct {
+	Name       string
+	Stage      Stage[T]
+	OnError    ErrorPolicy
+	Retries    int
+	RetryDelay time.Duration
+}
+
+// Pipeline runs its stages in order on every event.
+type Pipeline[T any] struct {
+	stages []StageConfig[T]
+}
+
+func New[T any](stages ...StageConfig[T]) *Pipeline[T] {
+	for i := range stages {
+		if stages[i].OnError == "" {
+			stages[i].OnError = Continue
+		}
+	}
+
+	return &Pipeline[T]{stages: stages}
+}
+
+// Process runs the stages on e and reports the stage that stopped it, empty
+// when every stage saw it, along with the errors of the stages that failed,
+// including the ones the event continued past.
+func (p *Pipeline[T]) Process(ctx context.Context, e *T) (stoppedBy string, err error) {
+	var errs []error
+
+	for _, stage := range p.stages {
+		stop, stageErr := p.run(ctx, stage, e)
+		if stageErr != nil {
+			errs = append(errs, stageErr)
+		}
+
+		if stop {
+			trace.SpanFromContext(ctx).SetAttributes(attribute.String("pipeline.stopped_by", stage.Name))
+			return stage.Name, errors.Join(errs...)
+		}
+	}
+
+	return "", errors.Join(errs...)
+}
+
+// run reports whether the event has to stop at the stage, along with the
+// error of the stage.
+func (p *Pipeline[T]) run(ctx context.Context, stage StageConfig[T], e *T) (bool, error) {
+	var (
+		start = time.Now()
+		err   error
+	)
+
+	for attempt := 0; ; attempt++ {
+		err = stage.Stage.Process(ctx, e)
+		if err == nil || errors.Is(err, ErrSkip) || stage.OnError != Retry ||
+			attempt >= stage.Retries || ctx.Err() != nil {
+			break
+		}
+
+		log.Warn("stage failed, retrying", "stage", stage.Name, "attempt", attempt+1, "error", err)
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(stage.RetryDelay):
+		}
+	}
+
+	result := "ok"
+
+	switch {
+	case errors.Is(err, ErrSkip):
+		result = "skipped"
+	case err != nil:
+		result = "error"
+		log.Error("stage failed", "stage", stage.Name, "on_error", stage.OnError, "error", err)
+	}
+
+	attrs := metric.WithAttributes(attribute.String("stage", stage.Name))
+	stageEvents.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("stage", stage.Name), attribute.String("result", result)))
+	stageDuration.Record(ctx, time.Since(start).Seconds(), attrs)
+
+	switch {
+	case errors.Is(err, ErrSkip):
+		return true, nil
+	case err != nil:
+		return stage.OnError == Skip, fmt.Errorf("stage %s: %w", stage.Name, err)
+	}
+
+	return false, nil
+}
@@ -0,0 +1,167 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type Options struct {
+	Level  string
+	Format string
+	// Components overrides the level per component, e.g. {"event": "debug"}.
+	Components map[string]string
+	Output     io.Writer
+}
+
+var (
+	base atomic.Pointer[slog.Handler]
+
+	mu           sync.Mutex
+	defaultLevel = slog.LevelInfo
+	overrides    = map[string]slog.Level{}
+	levels       = map[string]*slog.LevelVar{}
+)
+
+func init() {
+	var handler slog.Handler = slog.NewTextHandler(os.Stderr, nil)
+	base.Store(&handler)
+}
+
+// ParseLevel accepts debug, info, warn and error.
+func ParseLevel(level string) (slog.Level, error) {
+	var l slog.Level
+
+	switch strings.ToLower(level) {
+	case "debug", "info", "warn", "error":
+		err := l.UnmarshalText([]byte(level))
+		return l, err
+	default:
+		return l, fmt.Errorf("unknown log level %q", level)
+	}
+}
+
+// Setup switches every logger, including the ones created before, to the
+// given format and levels. It is safe to call again on config reload.
+func Setup(opts Options) error {
+	level, err := ParseLevel(opts.Level)
+	if err != nil {
+		return err
+	}
+
+	components := make(map[string]slog.Level, len(opts.Components))
+
+	for component, value := range opts.Components {
+		if components[component], err = ParseLevel(value); err != nil {
+			return fmt.Errorf("component %s: %w", component, err)
+		}
+	}
+
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+
+	// levels are checked per component before records reach the handler
+	handlerOpts := &slog.HandlerOptions{Level: slog.LevelDebug}
+
+	var handler slog.Handler
+
+	switch opts.Format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(opts.Output, handlerOpts)
+	case FormatText, "":
+		handler = slog.NewTextHandler(opts.Output, handlerOpts)
+	default:
+		return fmt.Errorf("unknown log format %q", opts.Format)
+	}
+
+	mu.Lock()
+
+	defaultLevel = level
+	overrides = components
+
+	for component, levelVar := range levels {
+		levelVar.Set(componentLevel(component))
+	}
+
+	mu.Unlock()
+
+	base.Store(&handler)
+	slog.SetDefault(For("main"))
+
+	return nil
+}
+
+// For returns the logger of a component, tagged with a component field and
+// filtered by the level configured for it.
+func For(component string) *slog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	levelVar, ok := levels[component]
+	if !ok {
+		levelVar = new(slog.LevelVar)
+		levelVar.Set(componentLevel(component))
+		levels[component] = levelVar
+	}
+
+	return slog.New(&handler{level: levelVar}).With("component", component)
+}
+
+func componentLevel(component string) slog.Level {
+	if level, ok := overrides[component]; ok {
+		return level
+	}
+
+	return defaultLevel
+}
+
+// handler resolves the output handler on every record so loggers held in
+// package variables follow Setup.
+type handler struct {
+	level *slog.LevelVar
+	with  []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	next := *base.Load()
+
+	for _, with := range h.with {
+		next = with(next)
+	}
+
+	return next.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.extend(func(next slog.Handler) slog.Handler {
+		return next.WithAttrs(attrs)
+	})
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.extend(func(next slog.Handler) slog.Handler {
+		return next.WithGroup(name)
+	})
+}
+
+func (h *handler) extend(with func(slog.Handler) slog.Handler) slog.Handler {
+	return &handler{
+		level: h.level,
+		with:  append(h.with[:len(h.with):len(h.with)], with),
+	}
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/metric"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+const instrumentation = "github.com/Sanjar0126/wiki_change_stream/"
+
+type Options struct {
+	Enabled bool
+	// Endpoint is the host:port of an OTLP/HTTP receiver such as a local
+	// collector.
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+	Interval    time.Duration
+}
+
+// Setup installs the global meter provider exporting metrics over OTLP/HTTP
+// every Interval. When metrics are disabled the no-op provider stays in
+// place. The returned function exports what was recorded since the last
+// interval.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if !opts.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOpts := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlpmetrichttp.WithInsecure())
+	}
+
+	exporter, err := otlpmetrichttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL, semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter, sdkmetric.WithInterval(opts.Interval))),
+		sdkmetric.WithResource(res),
+	)
+
+	otel.SetMeterProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// Meter returns the meter of a package. Instruments created from it before
+// Setup forward to the provider installed later.
+func Meter(name string) metric.Meter {
+	return otel.Meter(instrumentation + name)
+}
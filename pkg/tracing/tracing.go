@@ -0,0 +1,89 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github.com/Sanjar0126/wiki_change_stream/"
+
+type Options struct {
+	Enabled bool
+	// Endpoint is the host:port of an OTLP/HTTP receiver such as a local
+	// collector.
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+	SampleRatio float64
+}
+
+// Setup installs the global tracer provider exporting spans over OTLP/HTTP.
+// When tracing is disabled the no-op provider stays in place, so spans cost
+// next to nothing. The returned function flushes pending spans.
+func Setup(ctx context.Context, opts Options) (func(context.Context) error, error) {
+	if !opts.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporterOpts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(opts.Endpoint)}
+	if opts.Insecure {
+		exporterOpts = append(exporterOpts, otlptracehttp.WithInsecure())
+	}
+
+	exporter, err := otlptracehttp.New(ctx, exporterOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL, semconv.ServiceName(opts.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(opts.SampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the tracer of a package, resolved through the global
+// provider on every span so Setup may run after package initialization.
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer(instrumentation + name)
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// ChangeAttributes identify a change on its spans.
+func ChangeAttributes(wiki, metaID, changeType string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("wiki", wiki),
+		attribute.String("meta.id", metaID),
+		attribute.String("change.type", changeType),
+	}
+}
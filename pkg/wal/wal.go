@@ -0,0 +1,639 @@
+package wal
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/metrics"
+)
+
+const (
+	headerSize = 8
+	// maxRecordSize guards against allocating a bogus length read from a
+	// corrupt header.
+	maxRecordSize = 16 << 20
+	ackFile       = "ack.json"
+	extension     = ".wal"
+)
+
+var (
+	log   = logger.For("wal")
+	meter = metrics.Meter("wal")
+
+	walSize, _ = meter.Int64ObservableGauge("wal.size", metric.WithUnit("By"),
+		metric.WithDescription("Bytes taken by the write-ahead log segments"))
+	walPending, _ = meter.Int64ObservableGauge("wal.pending", metric.WithUnit("By"),
+		metric.WithDescription("Bytes of records not acknowledged yet"))
+	walRejected, _ = meter.Int64Counter("wal.rejected",
+		metric.WithDescription("Records not appended because the log was full"))
+	walCorrupt, _ = meter.Int64Counter("wal.corrupt",
+		metric.WithDescription("Corrupt records skipped along with the rest of their segment"))
+)
+
+// ErrFull is returned by Append when the log reached its size limit.
+var ErrFull = errors.New("write-ahead log is full")
+
+// errCorrupt marks a record that cannot be read back, as opposed to a
+// failing read.
+var errCorrupt = errors.New("corrupt record")
+
+type Options struct {
+	Dir string
+	// SegmentBytes is the size after which a new segment file is started,
+	// segments are deleted once every record in them was acknowledged.
+	SegmentBytes int64
+	// MaxBytes caps the size of all segments together.
+	MaxBytes int64
+}
+
+// Offset is the position of a record in the log.
+type Offset struct {
+	Segment uint64 `json:"segment"`
+	Pos     int64  `json:"pos"`
+}
+
+// Log is an append-only log of records split into segment files. Records are
+// read back in order by a single reader and stay on disk until acknowledged,
+// so the ones not acknowledged before a restart are read again.
+type Log struct {
+	opts Options
+
+	mu       sync.Mutex
+	segments map[uint64]int64
+	active   *os.File
+	activeID uint64
+	reader   *os.File
+	readerID uint64
+	read     Offset
+	ack      Offset
+	size     int64
+	changed  chan struct{}
+	// written counts the bytes appended since Open and synced the ones known
+	// to be on disk, appends wait for a sync covering their record.
+	written int64
+	synced  int64
+	syncMu  sync.Mutex
+}
+
+// Open opens the log in opts.Dir, creating it if needed. A record torn by a
+// crash while it was appended is cut off.
+func Open(opts Options) (*Log, error) {
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating write-ahead log directory: %w", err)
+	}
+
+	l := &Log{
+		opts:     opts,
+		segments: make(map[uint64]int64),
+		changed:  make(chan struct{}),
+	}
+
+	if err := l.loadAck(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading write-ahead log directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		id, err := strconv.ParseUint(strings.TrimSuffix(entry.Name(), extension), 10, 64)
+		if err != nil || !strings.HasSuffix(entry.Name(), extension) {
+			continue
+		}
+
+		if id < l.ack.Segment {
+			if err := os.Remove(l.path(id)); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		l.segments[id] = info.Size()
+		l.size += info.Size()
+	}
+
+	ids := l.ids()
+
+	if len(ids) == 0 {
+		l.activeID = max(l.ack.Segment, 1)
+		l.ack = Offset{Segment: l.activeID}
+	} else {
+		l.activeID = ids[len(ids)-1]
+
+		if err := l.repair(l.activeID); err != nil {
+			return nil, err
+		}
+
+		// an acknowledged position past a tail lost in a crash would skip
+		// the records appended from now on
+		if l.ack.Segment == l.activeID && l.ack.Pos > l.segments[l.activeID] {
+			l.ack.Pos = l.segments[l.activeID]
+		}
+	}
+
+	l.active, err = os.OpenFile(l.path(l.activeID), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening write-ahead log segment: %w", err)
+	}
+
+	if _, ok := l.segments[l.activeID]; !ok {
+		l.segments[l.activeID] = 0
+	}
+
+	l.read = l.ack
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(walSize, l.Size())
+		o.ObserveInt64(walPending, l.Pending())
+
+		return nil
+	}, walSize, walPending)
+	if err != nil {
+		log.Warn("error registering write-ahead log metrics", "error", err)
+	}
+
+	return l, nil
+}
+
+// Append writes a record and returns once it is synced to disk. Appends
+// running at the same time share a sync instead of waiting for one each.
+func (l *Log) Append(data []byte) error {
+	l.mu.Lock()
+
+	recordSize := int64(headerSize + len(data))
+
+	if l.size+recordSize > l.opts.MaxBytes {
+		l.mu.Unlock()
+		walRejected.Add(context.Background(), 1)
+
+		return ErrFull
+	}
+
+	if l.segments[l.activeID] >= l.opts.SegmentBytes {
+		if err := l.rotate(); err != nil {
+			l.mu.Unlock()
+			return err
+		}
+	}
+
+	record := make([]byte, recordSize)
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[headerSize:], data)
+
+	if _, err := l.active.Write(record); err != nil {
+		l.mu.Unlock()
+		return err
+	}
+
+	l.segments[l.activeID] += recordSize
+	l.size += recordSize
+	l.written += recordSize
+	target := l.written
+
+	l.mu.Unlock()
+
+	if err := l.sync(target); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.notify()
+	l.mu.Unlock()
+
+	return nil
+}
+
+// sync makes sure the bytes appended up to target are on disk. Appenders
+// queue on syncMu, so the one syncing covers every record written before it
+// started and those waiting behind it usually find nothing left to do.
+func (l *Log) sync(target int64) error {
+	l.syncMu.Lock()
+	defer l.syncMu.Unlock()
+
+	l.mu.Lock()
+	if l.synced >= target {
+		l.mu.Unlock()
+		return nil
+	}
+
+	active, written := l.active, l.written
+	l.mu.Unlock()
+
+	err := active.Sync()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// rotate syncs a segment before closing it
+	if errors.Is(err, os.ErrClosed) && l.synced >= target {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	l.synced = max(l.synced, written)
+
+	return nil
+}
+
+// Read blocks until records are available and returns up to limit of them,
+// along with the offset to acknowledge once they were handled.
+func (l *Log) Read(ctx context.Context, limit int) ([][]byte, Offset, error) {
+	for {
+		l.mu.Lock()
+
+		if !l.caughtUp(l.read) {
+			records, err := l.readRecords(limit)
+			next := l.read
+			l.mu.Unlock()
+
+			return records, next, err
+		}
+
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, Offset{}, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Ack marks every record before offset as handled and deletes the segments
+// holding only such records.
+func (l *Log) Ack(offset Offset) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// an offset at the end of a full segment frees it right away rather
+	// than with the next acknowledgement
+	if offset.Segment != l.activeID && offset.Pos >= l.segments[offset.Segment] {
+		offset = Offset{Segment: l.nextID(offset.Segment)}
+	}
+
+	l.ack = offset
+
+	for _, id := range l.ids() {
+		if id >= offset.Segment {
+			break
+		}
+
+		if id == l.readerID && l.reader != nil {
+			l.reader.Close()
+			l.reader = nil
+		}
+
+		if err := os.Remove(l.path(id)); err != nil {
+			return err
+		}
+
+		l.size -= l.segments[id]
+		delete(l.segments, id)
+	}
+
+	l.notify()
+
+	return l.saveAck()
+}
+
+// WaitEmpty blocks until every record was acknowledged.
+func (l *Log) WaitEmpty(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		empty := l.caughtUp(l.ack)
+		changed := l.changed
+		l.mu.Unlock()
+
+		if empty {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Size returns the bytes taken by all segments.
+func (l *Log) Size() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size
+}
+
+// Pending returns the bytes of records not acknowledged yet.
+func (l *Log) Pending() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	pending := -l.ack.Pos
+
+	for id, size := range l.segments {
+		if id >= l.ack.Segment {
+			pending += size
+		}
+	}
+
+	return pending
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.reader != nil {
+		l.reader.Close()
+	}
+
+	if err := l.active.Sync(); err != nil {
+		l.active.Close()
+		return err
+	}
+
+	return l.active.Close()
+}
+
+func (l *Log) caughtUp(offset Offset) bool {
+	return offset.Segment == l.activeID && offset.Pos >= l.segments[l.activeID]
+}
+
+func (l *Log) readRecords(limit int) ([][]byte, error) {
+	var records [][]byte
+
+	for len(records) < limit && !l.caughtUp(l.read) {
+		if l.read.Pos >= l.segments[l.read.Segment] {
+			l.read = Offset{Segment: l.nextID(l.read.Segment)}
+			continue
+		}
+
+		if l.reader == nil || l.readerID != l.read.Segment {
+			if l.reader != nil {
+				l.reader.Close()
+			}
+
+			reader, err := os.Open(l.path(l.read.Segment))
+			if err != nil {
+				return records, err
+			}
+
+			l.reader, l.readerID = reader, l.read.Segment
+		}
+
+		data, err := readRecord(l.reader, l.read.Pos)
+		if errors.Is(err, errCorrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+			if err := l.quarantine(err); err != nil {
+				return records, err
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return records, fmt.Errorf("error reading write-ahead log segment %d at %d: %w",
+				l.read.Segment, l.read.Pos, err)
+		}
+
+		records = append(records, data)
+		l.read.Pos += int64(headerSize + len(data))
+	}
+
+	return records, nil
+}
+
+// quarantine copies the rest of the segment from a corrupt record on to a
+// .corrupt file next to it and moves the reader past it, the records after
+// it cannot be told apart from garbage.
+func (l *Log) quarantine(reason error) error {
+	segment, pos := l.read.Segment, l.read.Pos
+	end := l.segments[segment]
+
+	data := make([]byte, end-pos)
+	if _, err := l.reader.ReadAt(data, pos); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("error reading corrupt write-ahead log records: %w", err)
+	}
+
+	path := fmt.Sprintf("%s.%d.corrupt", l.path(segment), pos)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("error quarantining corrupt write-ahead log records: %w", err)
+	}
+
+	log.Error("skipping corrupt write-ahead log records", "segment", segment, "pos", pos,
+		"bytes", len(data), "file", path, "error", reason)
+	walCorrupt.Add(context.Background(), 1)
+
+	l.read.Pos = end
+
+	return nil
+}
+
+// repair cuts off a record left incomplete or corrupt at the end of a
+// segment.
+func (l *Log) repair(id uint64) error {
+	file, err := os.OpenFile(l.path(id), os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var pos int64
+
+	for pos < l.segments[id] {
+		data, err := readRecord(file, pos)
+		if err != nil {
+			break
+		}
+
+		pos += int64(headerSize + len(data))
+	}
+
+	if pos == l.segments[id] {
+		return nil
+	}
+
+	log.Warn("cutting off torn write-ahead log record", "segment", id, "pos", pos,
+		"bytes", l.segments[id]-pos)
+
+	if err := file.Truncate(pos); err != nil {
+		return err
+	}
+
+	l.size -= l.segments[id] - pos
+	l.segments[id] = pos
+
+	return nil
+}
+
+func (l *Log) rotate() error {
+	if err := l.active.Sync(); err != nil {
+		return err
+	}
+
+	l.synced = l.written
+
+	if err := l.active.Close(); err != nil {
+		return err
+	}
+
+	id := l.activeID + 1
+
+	active, err := os.OpenFile(l.path(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("error creating write-ahead log segment: %w", err)
+	}
+
+	l.active, l.activeID = active, id
+	l.segments[id] = 0
+
+	return nil
+}
+
+func (l *Log) notify() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+func (l *Log) ids() []uint64 {
+	ids := make([]uint64, 0, len(l.segments))
+	for id := range l.segments {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+func (l *Log) nextID(id uint64) uint64 {
+	for _, next := range l.ids() {
+		if next > id {
+			return next
+		}
+	}
+
+	return l.activeID
+}
+
+func (l *Log) path(id uint64) string {
+	return filepath.Join(l.opts.Dir, fmt.Sprintf("%020d%s", id, extension))
+}
+
+func (l *Log) loadAck() error {
+	data, err := os.ReadFile(filepath.Join(l.opts.Dir, ackFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &l.ack); err != nil {
+		return fmt.Errorf("error reading write-ahead log position: %w", err)
+	}
+
+	return nil
+}
+
+// saveAck replaces the ack file through a rename, so a crash leaves either
+// the old or the new position.
+func (l *Log) saveAck() error {
+	data, err := json.Marshal(l.ack)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(l.opts.Dir, ackFile)
+
+	tmp, err := os.OpenFile(path+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	// the rename itself is only durable once the directory is synced
+	dir, err := os.Open(l.opts.Dir)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+
+	return dir.Sync()
+}
+
+func readRecord(file *os.File, pos int64) ([]byte, error) {
+	header := make([]byte, headerSize)
+	if _, err := file.ReadAt(header, pos); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	if length > maxRecordSize {
+		return nil, fmt.Errorf("%w: length %d out of range", errCorrupt, length)
+	}
+
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, pos+headerSize); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.ErrUnexpectedEOF
+		}
+
+		return nil, err
+	}
+
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, fmt.Errorf("%w: checksum mismatch", errCorrupt)
+	}
+
+	return data, nil
+}
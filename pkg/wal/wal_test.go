@@ -0,0 +1,300 @@
+package wal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openLog(t *testing.T, dir string, segmentBytes, maxBytes int64) *Log {
+	t.Helper()
+
+	l, err := Open(Options{Dir: dir, SegmentBytes: segmentBytes, MaxBytes: maxBytes})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	return l
+}
+
+func appendAll(t *testing.T, l *Log, records ...string) {
+	t.Helper()
+
+	for _, record := range records {
+		if err := l.Append([]byte(record)); err != nil {
+			t.Fatalf("Append(%q): %v", record, err)
+		}
+	}
+}
+
+// readN reads until n records were returned and gives the offset to
+// acknowledge them with.
+func readN(t *testing.T, l *Log, n int) ([]string, Offset) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var (
+		records []string
+		offset  Offset
+	)
+
+	for len(records) < n {
+		batch, next, err := l.Read(ctx, n-len(records))
+		if err != nil {
+			t.Fatalf("Read after %d of %d records: %v", len(records), n, err)
+		}
+
+		for _, record := range batch {
+			records = append(records, string(record))
+		}
+
+		offset = next
+	}
+
+	return records, offset
+}
+
+// assertCaughtUp checks that no record is left to read.
+func assertCaughtUp(t *testing.T, l *Log) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	if records, _, err := l.Read(ctx, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Read = %q, %v, want nothing left", records, err)
+	}
+}
+
+func assertRecords(t *testing.T, got []string, want ...string) {
+	t.Helper()
+
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("records = %q, want %q", got, want)
+	}
+}
+
+func TestOpenRepairsTornTail(t *testing.T) {
+	tests := []struct {
+		name string
+		tail []byte
+	}{
+		{"partial header", []byte{0, 0, 0}},
+		{"partial data", []byte{0, 0, 0, 10, 1, 2, 3, 4, 'a', 'b'}},
+		{"checksum mismatch", []byte{0, 0, 0, 2, 1, 2, 3, 4, 'a', 'b'}},
+		{"length out of range", []byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			l := openLog(t, dir, 1<<20, 1<<20)
+			appendAll(t, l, "one", "two")
+
+			if err := l.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			segment := filepath.Join(dir, fmt.Sprintf("%020d%s", 1, extension))
+
+			file, err := os.OpenFile(segment, os.O_WRONLY|os.O_APPEND, 0o644)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := file.Write(tt.tail); err != nil {
+				t.Fatal(err)
+			}
+
+			file.Close()
+
+			l = openLog(t, dir, 1<<20, 1<<20)
+			defer l.Close()
+
+			if want := int64(2 * (headerSize + 3)); l.Size() != want {
+				t.Errorf("Size = %d, want %d", l.Size(), want)
+			}
+
+			appendAll(t, l, "three")
+
+			records, _ := readN(t, l, 3)
+			assertRecords(t, records, "one", "two", "three")
+			assertCaughtUp(t, l)
+		})
+	}
+}
+
+func TestAckAcrossSegments(t *testing.T) {
+	records := []string{"r1", "r2", "r3", "r4", "r5"}
+
+	tests := []struct {
+		name      string
+		acked     int
+		remaining []string
+		// segments left on disk, every record gets its own segment
+		segments int
+	}{
+		{"nothing", 0, records, 5},
+		{"first segment", 1, records[1:], 4},
+		{"middle", 3, records[3:], 2},
+		{"all", 5, nil, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// a segment holds a single record before the next one starts
+			l := openLog(t, dir, 1, 1<<20)
+			appendAll(t, l, records...)
+
+			if tt.acked > 0 {
+				_, offset := readN(t, l, tt.acked)
+
+				if err := l.Ack(offset); err != nil {
+					t.Fatalf("Ack: %v", err)
+				}
+			}
+
+			if err := l.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			segments, err := filepath.Glob(filepath.Join(dir, "*"+extension))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(segments) != tt.segments {
+				t.Errorf("segments = %d, want %d", len(segments), tt.segments)
+			}
+
+			l = openLog(t, dir, 1, 1<<20)
+			defer l.Close()
+
+			if want := int64(len(tt.remaining) * (headerSize + 2)); l.Pending() != want {
+				t.Errorf("Pending = %d, want %d", l.Pending(), want)
+			}
+
+			got, _ := readN(t, l, len(tt.remaining))
+			assertRecords(t, got, tt.remaining...)
+			assertCaughtUp(t, l)
+		})
+	}
+}
+
+func TestAppendFull(t *testing.T) {
+	const recordSize = headerSize + 4
+
+	tests := []struct {
+		name     string
+		maxBytes int64
+		appended int
+	}{
+		{"no room", recordSize - 1, 0},
+		{"exact fit", 3 * recordSize, 3},
+		{"partial room", 3*recordSize + recordSize/2, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := openLog(t, t.TempDir(), 1<<20, tt.maxBytes)
+			defer l.Close()
+
+			appended := 0
+
+			for {
+				err := l.Append([]byte("data"))
+				if errors.Is(err, ErrFull) {
+					break
+				}
+
+				if err != nil {
+					t.Fatalf("Append: %v", err)
+				}
+
+				appended++
+			}
+
+			if appended != tt.appended {
+				t.Errorf("appended %d records before ErrFull, want %d", appended, tt.appended)
+			}
+
+			if l.Size() > tt.maxBytes {
+				t.Errorf("Size = %d, over the limit of %d", l.Size(), tt.maxBytes)
+			}
+		})
+	}
+}
+
+func TestAckFreesRoom(t *testing.T) {
+	const recordSize = headerSize + 4
+
+	l := openLog(t, t.TempDir(), 1, 2*recordSize)
+	defer l.Close()
+
+	appendAll(t, l, "aaaa", "bbbb")
+
+	if err := l.Append([]byte("cccc")); !errors.Is(err, ErrFull) {
+		t.Fatalf("Append on a full log = %v, want ErrFull", err)
+	}
+
+	_, offset := readN(t, l, 1)
+
+	if err := l.Ack(offset); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+
+	appendAll(t, l, "cccc")
+
+	records, _ := readN(t, l, 2)
+	assertRecords(t, records, "bbbb", "cccc")
+}
+
+func TestReadQuarantinesCorruptSegment(t *testing.T) {
+	dir := t.TempDir()
+
+	l := openLog(t, dir, 2*(headerSize+3), 1<<20)
+	appendAll(t, l, "one", "two", "six", "ten")
+
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// flip a byte of "two", which is in the first segment and not repaired
+	// on open since only the active segment is
+	segment := filepath.Join(dir, fmt.Sprintf("%020d%s", 1, extension))
+
+	file, err := os.OpenFile(segment, os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.WriteAt([]byte("X"), 2*headerSize+3); err != nil {
+		t.Fatal(err)
+	}
+
+	file.Close()
+
+	l = openLog(t, dir, 2*(headerSize+3), 1<<20)
+	defer l.Close()
+
+	records, _ := readN(t, l, 3)
+	assertRecords(t, records, "one", "six", "ten")
+
+	quarantined, err := os.ReadFile(fmt.Sprintf("%s.%d.corrupt", segment, headerSize+3))
+	if err != nil {
+		t.Fatalf("reading quarantined records: %v", err)
+	}
+
+	if len(quarantined) != headerSize+3 {
+		t.Errorf("quarantined %d bytes, want %d", len(quarantined), headerSize+3)
+	}
+}
@@ -0,0 +1,153 @@
+package wikisite
+
+import (
+	"strings"
+)
+
+// Site describes a wiki by its language and project family, e.g. en and
+// wiktionary for en.wiktionary.org. Special wikis such as Commons or
+// Wikidata have no language, their project is the wiki itself.
+type Site struct {
+	Language string
+	Project  string
+	Special  bool
+	// name is the short name of a special wiki, test for test.wikipedia.org
+	name string
+}
+
+// Projects are the families with one wiki per language.
+var Projects = map[string]bool{
+	"wikipedia":   true,
+	"wiktionary":  true,
+	"wikibooks":   true,
+	"wikinews":    true,
+	"wikiquote":   true,
+	"wikisource":  true,
+	"wikiversity": true,
+	"wikivoyage":  true,
+}
+
+// specialDomains are wikis on a domain of their own.
+var specialDomains = map[string]string{
+	"wikidata.org":            "wikidata",
+	"mediawiki.org":           "mediawiki",
+	"wikifunctions.org":       "wikifunctions",
+	"wikimediafoundation.org": "foundation",
+}
+
+// nonLanguages are subdomains and database name prefixes that are not
+// languages, the database names of special wikis end in wiki as well.
+var nonLanguages = map[string]bool{
+	"test":          true,
+	"test2":         true,
+	"beta":          true,
+	"commons":       true,
+	"meta":          true,
+	"species":       true,
+	"incubator":     true,
+	"sources":       true,
+	"wikidata":      true,
+	"testwikidata":  true,
+	"mediawiki":     true,
+	"wikifunctions": true,
+	"foundation":    true,
+	"outreach":      true,
+	"wikimania":     true,
+	"login":         true,
+}
+
+// Parse derives the site from the server name of a change, falling back to
+// the database name, e.g. enwiktionary, when the server name is unknown.
+func Parse(serverName, dbName string) Site {
+	labels := strings.Split(strings.ToLower(strings.TrimSpace(serverName)), ".")
+	if len(labels) < 2 {
+		return parseDBName(dbName)
+	}
+
+	domain := strings.Join(labels[len(labels)-2:], ".")
+	subdomains := make([]string, 0, len(labels)-2)
+
+	for _, label := range labels[:len(labels)-2] {
+		if label != "www" && label != "m" {
+			subdomains = append(subdomains, label)
+		}
+	}
+
+	if project, ok := specialDomains[domain]; ok {
+		return Site{Project: project, Special: true, name: project}
+	}
+
+	project := strings.TrimSuffix(domain, ".org")
+
+	switch {
+	case project == "wikimedia" && len(subdomains) > 0:
+		return Site{Project: subdomains[0], Special: true, name: subdomains[0]}
+	case !Projects[project]:
+		return parseDBName(dbName)
+	case len(subdomains) == 0:
+		// wikisource.org hosts the texts in languages without a wiki of
+		// their own
+		return Site{Project: project, Special: true, name: project}
+	case nonLanguages[subdomains[0]]:
+		return Site{Project: project, Special: true, name: subdomains[0]}
+	}
+
+	return Site{Language: subdomains[0], Project: project}
+}
+
+// parseDBName handles database names of language wikis, other wikis are
+// reported as special with the database name as project.
+func parseDBName(dbName string) Site {
+	dbName = strings.ToLower(strings.TrimSpace(dbName))
+	if dbName == "" {
+		return Site{}
+	}
+
+	for project := range Projects {
+		suffix := project
+		if project == "wikipedia" {
+			suffix = "wiki"
+		}
+
+		language, ok := strings.CutSuffix(dbName, suffix)
+		if ok && language != "" && !nonLanguages[language] {
+			return Site{Language: strings.ReplaceAll(language, "_", "-"), Project: project}
+		}
+	}
+
+	name := strings.TrimSuffix(dbName, "wiki")
+
+	return Site{Project: name, Special: true, name: name}
+}
+
+// Prefix is the short name of the site, its language or the name of a
+// special wiki.
+func (s Site) Prefix() string {
+	if s.Special {
+		return s.name
+	}
+
+	return s.Language
+}
+
+// ServerName returns the server name of the wiki with the given prefix in a
+// project, e.g. en.wiktionary.org or commons.wikimedia.org. The project
+// defaults to wikipedia.
+func ServerName(prefix, project string) string {
+	if project == "" {
+		project = "wikipedia"
+	}
+
+	switch {
+	case project == "foundation":
+		return "wikimediafoundation.org"
+	case !Projects[project] && specialDomains[project+".org"] != "":
+		return "www." + project + ".org"
+	case !Projects[project]:
+		return project + ".wikimedia.org"
+	case prefix == project:
+		return project + ".org"
+	}
+
+	return prefix + "." + project + ".org"
+}
@@ -0,0 +1,98 @@
+package wikisite
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		serverName string
+		dbName     string
+		want       Site
+	}{
+		{"en.wikipedia.org", "enwiki", Site{Language: "en", Project: "wikipedia"}},
+		{"de.wiktionary.org", "", Site{Language: "de", Project: "wiktionary"}},
+		{"EN.m.Wikipedia.org ", "", Site{Language: "en", Project: "wikipedia"}},
+		{"zh-min-nan.wikipedia.org", "", Site{Language: "zh-min-nan", Project: "wikipedia"}},
+		{"test.wikipedia.org", "testwiki", Site{Project: "wikipedia", Special: true, name: "test"}},
+		{"species.wikimedia.org", "", Site{Project: "species", Special: true, name: "species"}},
+		{"commons.wikimedia.org", "commonswiki", Site{Project: "commons", Special: true, name: "commons"}},
+		{"www.wikidata.org", "wikidatawiki", Site{Project: "wikidata", Special: true, name: "wikidata"}},
+		{"wikidata.org", "", Site{Project: "wikidata", Special: true, name: "wikidata"}},
+		{"wikimediafoundation.org", "", Site{Project: "foundation", Special: true, name: "foundation"}},
+		{"wikisource.org", "sourceswiki", Site{Project: "wikisource", Special: true, name: "wikisource"}},
+		{"", "frwikiquote", Site{Language: "fr", Project: "wikiquote"}},
+		{"", "be_x_oldwiki", Site{Language: "be-x-old", Project: "wikipedia"}},
+		{"", "metawiki", Site{Project: "meta", Special: true, name: "meta"}},
+		{"localhost", "enwikibooks", Site{Language: "en", Project: "wikibooks"}},
+		{"example.org", "", Site{}},
+		{"", "", Site{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.serverName+"|"+tt.dbName, func(t *testing.T) {
+			if got := Parse(tt.serverName, tt.dbName); got != tt.want {
+				t.Errorf("Parse(%q, %q) = %+v, want %+v", tt.serverName, tt.dbName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerName(t *testing.T) {
+	tests := []struct {
+		prefix  string
+		project string
+		want    string
+	}{
+		{"en", "", "en.wikipedia.org"},
+		{"fr", "wiktionary", "fr.wiktionary.org"},
+		{"test", "wikipedia", "test.wikipedia.org"},
+		{"wikisource", "wikisource", "wikisource.org"},
+		{"commons", "commons", "commons.wikimedia.org"},
+		{"meta", "meta", "meta.wikimedia.org"},
+		{"wikidata", "wikidata", "www.wikidata.org"},
+		{"mediawiki", "mediawiki", "www.mediawiki.org"},
+		{"foundation", "foundation", "wikimediafoundation.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := ServerName(tt.prefix, tt.project); got != tt.want {
+				t.Errorf("ServerName(%q, %q) = %q, want %q", tt.prefix, tt.project, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestRoundTrip checks that the server name built from a parsed site parses
+// back to the same site.
+func TestRoundTrip(t *testing.T) {
+	serverNames := []string{
+		"en.wikipedia.org",
+		"ja.wikivoyage.org",
+		"pt.wikinews.org",
+		"test.wikipedia.org",
+		"test2.wikipedia.org",
+		"wikisource.org",
+		"commons.wikimedia.org",
+		"meta.wikimedia.org",
+		"species.wikimedia.org",
+		"www.wikidata.org",
+		"www.wikifunctions.org",
+		"www.mediawiki.org",
+		"wikimediafoundation.org",
+	}
+
+	for _, serverName := range serverNames {
+		t.Run(serverName, func(t *testing.T) {
+			site := Parse(serverName, "")
+
+			built := ServerName(site.Prefix(), site.Project)
+			if built != serverName {
+				t.Errorf("ServerName(%q, %q) = %q, want %q", site.Prefix(), site.Project, built, serverName)
+			}
+
+			if again := Parse(built, ""); again != site {
+				t.Errorf("Parse(%q) = %+v, want %+v", built, again, site)
+			}
+		})
+	}
+}
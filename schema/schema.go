@@ -0,0 +1,161 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
+)
+
+var log = logger.For("schema")
+
+const recentChangePrefix = "/mediawiki/recentchange/"
+
+var (
+	ErrUnknownSchema = errors.New("unknown schema")
+	ErrMissingField  = errors.New("missing required field")
+)
+
+type decoder func(data []byte) (models.WikiRecentChanges, error)
+
+// Registry decodes recentchange events by their $schema version and keeps
+// count of every version seen so upstream bumps are noticed early.
+type Registry struct {
+	decoders map[string]decoder
+	latest   string
+
+	mu   sync.Mutex
+	seen map[string]int64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		decoders: map[string]decoder{
+			"1.0.0": decodeV1,
+			"1.0.1": decodeV1,
+		},
+		latest: "1.0.1",
+		seen:   make(map[string]int64),
+	}
+}
+
+func (r *Registry) Decode(data []byte) (models.WikiRecentChanges, error) {
+	var (
+		header struct {
+			Schema string `json:"$schema"`
+		}
+	)
+
+	if err := json.Unmarshal(data, &header); err != nil {
+		return models.WikiRecentChanges{}, fmt.Errorf("error unmarshaling event: %w", err)
+	}
+
+	version, ok := strings.CutPrefix(header.Schema, recentChangePrefix)
+	if !ok || version == "" {
+		r.count(header.Schema)
+		return models.WikiRecentChanges{}, fmt.Errorf("%w: %q", ErrUnknownSchema, header.Schema)
+	}
+
+	decode, known := r.decoders[version]
+	if !known {
+		if major(version) != major(r.latest) {
+			r.count(header.Schema)
+			return models.WikiRecentChanges{}, fmt.Errorf("%w: %q", ErrUnknownSchema, header.Schema)
+		}
+
+		// a new minor or patch version stays compatible, so it is decoded
+		// with the latest known decoder
+		decode = r.decoders[r.latest]
+	}
+
+	if r.count(header.Schema) == 1 && !known {
+		log.Warn("first event with unknown schema version", "version", version, "decoder", r.latest)
+	}
+
+	e, err := decode(data)
+	if err != nil {
+		return e, err
+	}
+
+	return e, Validate(e)
+}
+
+func (r *Registry) Seen() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]int64, len(r.seen))
+	for version, count := range r.seen {
+		seen[version] = count
+	}
+
+	return seen
+}
+
+func (r *Registry) count(schema string) int64 {
+	if schema == "" {
+		schema = "none"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.seen[schema]++
+
+	return r.seen[schema]
+}
+
+func Validate(e models.WikiRecentChanges) error {
+	required := map[string]bool{
+		"meta.id":     e.Meta.ID != "",
+		"meta.dt":     !e.Meta.Dt.IsZero(),
+		"meta.stream": e.Meta.Stream != "",
+		"type":        e.Type != "",
+		"server_name": e.ServerName != "",
+		"wiki":        e.Wiki != "",
+		"timestamp":   e.Timestamp > 0,
+	}
+
+	switch e.Type {
+	case "edit", "new":
+		required["revision.new"] = e.Revision.New != 0
+	case "log":
+		required["log_type"] = e.LogType != ""
+	}
+
+	var missing []string
+
+	for field, ok := range required {
+		if !ok {
+			missing = append(missing, field)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+
+		return fmt.Errorf("%w: %s", ErrMissingField, strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+func decodeV1(data []byte) (models.WikiRecentChanges, error) {
+	var e models.WikiRecentChanges
+
+	if err := json.Unmarshal(data, &e); err != nil {
+		return e, fmt.Errorf("error unmarshaling event: %w", err)
+	}
+
+	return e, nil
+}
+
+func major(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
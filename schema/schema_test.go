@@ -0,0 +1,163 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// event encodes a complete edit under schema after applying edit to it.
+func event(t *testing.T, schema string, edit func(e map[string]any)) []byte {
+	t.Helper()
+
+	e := map[string]any{
+		"$schema": schema,
+		"meta": map[string]any{
+			"id":     "8f2c1c3e-0000-4000-8000-000000000000",
+			"dt":     "2024-05-01T12:00:00Z",
+			"stream": "mediawiki.recentchange",
+		},
+		"type":        "edit",
+		"title":       "Main Page",
+		"timestamp":   1714564800,
+		"server_name": "en.wikipedia.org",
+		"wiki":        "enwiki",
+		"revision":    map[string]any{"old": 1, "new": 2},
+	}
+
+	if edit != nil {
+		edit(e)
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestRegistryDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		edit   func(e map[string]any)
+		err    error
+		reason string
+	}{
+		{name: "known version", schema: "/mediawiki/recentchange/1.0.1"},
+		{name: "older known version", schema: "/mediawiki/recentchange/1.0.0"},
+		{name: "newer minor version", schema: "/mediawiki/recentchange/1.2.0"},
+		{name: "newer major version", schema: "/mediawiki/recentchange/2.0.0", err: ErrUnknownSchema},
+		{name: "other schema", schema: "/mediawiki/page/change/1.0.0", err: ErrUnknownSchema},
+		{name: "no version", schema: "/mediawiki/recentchange/", err: ErrUnknownSchema},
+		{name: "no schema", err: ErrUnknownSchema},
+		{
+			name:   "missing meta fields",
+			schema: "/mediawiki/recentchange/1.0.1",
+			edit: func(e map[string]any) {
+				e["meta"] = map[string]any{"stream": "mediawiki.recentchange"}
+			},
+			err:    ErrMissingField,
+			reason: "meta.dt, meta.id",
+		},
+		{
+			name:   "edit without a revision",
+			schema: "/mediawiki/recentchange/1.0.1",
+			edit:   func(e map[string]any) { delete(e, "revision") },
+			err:    ErrMissingField,
+			reason: "revision.new",
+		},
+		{
+			name:   "log without a log type",
+			schema: "/mediawiki/recentchange/1.0.1",
+			edit:   func(e map[string]any) { e["type"] = "log" },
+			err:    ErrMissingField,
+			reason: "log_type",
+		},
+		{
+			name:   "log with a log type",
+			schema: "/mediawiki/recentchange/1.0.1",
+			edit: func(e map[string]any) {
+				e["type"] = "log"
+				e["log_type"] = "delete"
+				delete(e, "revision")
+			},
+		},
+		{
+			name:   "categorize without a revision",
+			schema: "/mediawiki/recentchange/1.0.1",
+			edit: func(e map[string]any) {
+				e["type"] = "categorize"
+				delete(e, "revision")
+			},
+		},
+		{
+			name:   "missing type and server",
+			schema: "/mediawiki/recentchange/1.0.1",
+			edit: func(e map[string]any) {
+				delete(e, "type")
+				delete(e, "server_name")
+				delete(e, "timestamp")
+			},
+			err:    ErrMissingField,
+			reason: "server_name, timestamp, type",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := NewRegistry().Decode(event(t, tt.schema, tt.edit))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Decode error = %v, want %v", err, tt.err)
+			}
+
+			if tt.reason != "" && !strings.HasSuffix(err.Error(), ": "+tt.reason) {
+				t.Errorf("Decode error = %v, want missing %s", err, tt.reason)
+			}
+
+			if err == nil && e.ServerName != "en.wikipedia.org" {
+				t.Errorf("decoded server name %q", e.ServerName)
+			}
+		})
+	}
+}
+
+func TestRegistryDecodeMalformed(t *testing.T) {
+	if _, err := NewRegistry().Decode([]byte(`{"$schema":`)); err == nil || errors.Is(err, ErrUnknownSchema) {
+		t.Errorf("Decode error = %v, want an unmarshal error", err)
+	}
+}
+
+func TestRegistrySeen(t *testing.T) {
+	r := NewRegistry()
+
+	for _, schema := range []string{
+		"/mediawiki/recentchange/1.0.1",
+		"/mediawiki/recentchange/1.0.1",
+		"/mediawiki/recentchange/1.1.0",
+		"/mediawiki/recentchange/2.0.0",
+		"",
+	} {
+		_, _ = r.Decode(event(t, schema, nil))
+	}
+
+	want := map[string]int64{
+		"/mediawiki/recentchange/1.0.1": 2,
+		"/mediawiki/recentchange/1.1.0": 1,
+		"/mediawiki/recentchange/2.0.0": 1,
+		"none":                          1,
+	}
+
+	seen := r.Seen()
+	if len(seen) != len(want) {
+		t.Fatalf("Seen = %v, want %v", seen, want)
+	}
+
+	for schema, count := range want {
+		if seen[schema] != count {
+			t.Errorf("Seen[%q] = %d, want %d", schema, seen[schema], count)
+		}
+	}
+}
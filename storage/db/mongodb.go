@@ -6,12 +6,14 @@ import (
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-
-	"log"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
 
 	"github.com/Sanjar0126/wiki_change_stream/config"
+	"github.com/Sanjar0126/wiki_change_stream/pkg/logger"
 )
 
+var log = logger.For("storage")
+
 type DB struct {
 	MongoConn *mongo.Database
 }
@@ -23,42 +25,43 @@ func NewConn(cfg *config.Config) *DB {
 	)
 
 	credential := options.Credential{
-		AuthSource:    cfg.MongoDBDatabase,
-		Username:      cfg.MongoDBUser,
-		Password:      cfg.MongoDBPassword,
+		AuthSource:    cfg.Storage.Database,
+		Username:      cfg.Storage.User,
+		Password:      cfg.Storage.Password,
 		AuthMechanism: "SCRAM-SHA-256",
 	}
 
-	mongoString := fmt.Sprintf("mongodb://%s:%d", cfg.MongoDBHost, cfg.MongoDBPort)
+	mongoString := fmt.Sprintf("mongodb://%s:%d", cfg.Storage.Host, cfg.Storage.Port)
+
+	log.Info("connecting to mongodb", "uri", mongoString)
 
-	log.Println("Connecting:", mongoString)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Storage.Timeouts.Connect)
+	defer cancel()
 
-	ctx := context.Background()
+	clientOptions := options.Client().
+		ApplyURI(mongoString).
+		SetConnectTimeout(cfg.Storage.Timeouts.Connect).
+		SetServerSelectionTimeout(cfg.Storage.Timeouts.Connect).
+		SetMonitor(otelmongo.NewMonitor())
 
 	if cfg.Environment == "develop" {
-		mongoConn, err = mongo.Connect(
-			ctx,
-			options.Client().ApplyURI(mongoString),
-		)
+		mongoConn, err = mongo.Connect(ctx, clientOptions)
 	} else {
-		mongoConn, err = mongo.Connect(
-			ctx,
-			options.Client().ApplyURI(mongoString).SetAuth(credential),
-		)
+		mongoConn, err = mongo.Connect(ctx, clientOptions.SetAuth(credential))
 	}
 
 	if err != nil {
-		log.Printf("failed to connecto to mongodb, %v", err)
+		log.Error("failed to connect to mongodb", "uri", mongoString, "error", err)
 		panic(err)
 	}
 
-	if err := mongoConn.Ping(context.TODO(), nil); err != nil {
-		log.Printf("failed to connecto to database, %v", err)
+	if err := mongoConn.Ping(ctx, nil); err != nil {
+		log.Error("failed to ping mongodb", "uri", mongoString, "error", err)
 		panic(err)
 	}
 
-	connDB := mongoConn.Database(cfg.MongoDBDatabase)
-	log.Printf("Connected to MongoDBdatabase: %v", connDB.Name())
+	connDB := mongoConn.Database(cfg.Storage.Database)
+	log.Info("connected to mongodb", "database", connDB.Name())
 
 	return &DB{
 		MongoConn: connDB,
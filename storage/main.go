@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"context"
+
 	db "go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/Sanjar0126/wiki_change_stream/storage/mongo"
@@ -10,17 +12,35 @@ import (
 type StorageI interface {
 	WikiChanges() repo.WikiChangesI
 	DiscordUser() repo.DiscordUserI
+	DiscordSubscription() repo.DiscordSubscriptionI
+	DiscordGuild() repo.DiscordGuildI
+	EditWar() repo.EditWarI
+	DeadLetter() repo.DeadLetterI
+	Checkpoint() repo.CheckpointI
+	Migrate(ctx context.Context) error
 }
 
 type storageMDB struct {
-	wikiChangesRepo repo.WikiChangesI
-	discordUserRepo repo.DiscordUserI
+	db               *db.Database
+	wikiChangesRepo  repo.WikiChangesI
+	discordUserRepo  repo.DiscordUserI
+	discordSubRepo   repo.DiscordSubscriptionI
+	discordGuildRepo repo.DiscordGuildI
+	editWarRepo      repo.EditWarI
+	deadLetterRepo   repo.DeadLetterI
+	checkpointRepo   repo.CheckpointI
 }
 
-func New(db *db.Database) StorageI {
+func New(db *db.Database, timeouts mongo.Timeouts) StorageI {
 	return &storageMDB{
-		wikiChangesRepo: mongo.NewWikiChangesRepo(db),
-		discordUserRepo: mongo.NewDiscordUserRepo(db),
+		db:               db,
+		wikiChangesRepo:  mongo.NewWikiChangesRepo(db, timeouts),
+		discordUserRepo:  mongo.NewDiscordUserRepo(db, timeouts),
+		discordSubRepo:   mongo.NewDiscordSubscriptionRepo(db, timeouts),
+		discordGuildRepo: mongo.NewDiscordGuildRepo(db, timeouts),
+		editWarRepo:      mongo.NewEditWarRepo(db, timeouts),
+		deadLetterRepo:   mongo.NewDeadLetterRepo(db, timeouts),
+		checkpointRepo:   mongo.NewCheckpointRepo(db, timeouts),
 	}
 }
 
@@ -31,3 +51,27 @@ func (s *storageMDB) WikiChanges() repo.WikiChangesI {
 func (s *storageMDB) DiscordUser() repo.DiscordUserI {
 	return s.discordUserRepo
 }
+
+func (s *storageMDB) DiscordSubscription() repo.DiscordSubscriptionI {
+	return s.discordSubRepo
+}
+
+func (s *storageMDB) DiscordGuild() repo.DiscordGuildI {
+	return s.discordGuildRepo
+}
+
+func (s *storageMDB) EditWar() repo.EditWarI {
+	return s.editWarRepo
+}
+
+func (s *storageMDB) DeadLetter() repo.DeadLetterI {
+	return s.deadLetterRepo
+}
+
+func (s *storageMDB) Checkpoint() repo.CheckpointI {
+	return s.checkpointRepo
+}
+
+func (s *storageMDB) Migrate(ctx context.Context) error {
+	return mongo.Migrate(ctx, s.db)
+}
@@ -0,0 +1,102 @@
+package mongo
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+type editWarStorage struct {
+	collection *mongo.Collection
+	timeouts   Timeouts
+}
+
+func NewEditWarRepo(db *mongo.Database, timeouts Timeouts) repo.EditWarI {
+	return &editWarStorage{
+		collection: db.Collection(repo.EditWarCollection),
+		timeouts:   timeouts,
+	}
+}
+
+func (f *editWarStorage) Create(
+	ctx context.Context, req models.EditWarIncident) (string, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	req.BId = primitive.NewObjectID()
+
+	_, err := f.collection.InsertOne(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	return req.BId.Hex(), nil
+}
+
+func (f *editWarStorage) GetAll(ctx context.Context, offset, limit int64, wiki string) (
+	[]*models.EditWarIncident, int32, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Count)
+	defer cancel()
+
+	var (
+		response []*models.EditWarIncident
+	)
+
+	opts := options.Find()
+	opts.SetLimit(limit)
+	opts.SetSkip(offset)
+	opts.SetSort(bson.M{"detected_at": -1})
+
+	filtering := bson.M{}
+	if wiki != "" {
+		filtering["wiki"] = wiki
+	}
+
+	count, err := f.collection.CountDocuments(ctx, filtering)
+	if err != nil {
+		return response, 0, err
+	}
+
+	rows, err := f.collection.Find(ctx, filtering, opts)
+	if err != nil {
+		return response, 0, err
+	}
+
+	if err := rows.All(ctx, &response); err != nil {
+		return response, 0, err
+	}
+
+	return response, int32(count), nil
+}
+
+// GetDetected returns the incidents detected in [from, to), oldest first.
+func (f *editWarStorage) GetDetected(ctx context.Context, from, to time.Time) (
+	[]*models.EditWarIncident, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
+	var (
+		response []*models.EditWarIncident
+	)
+
+	opts := options.Find()
+	opts.SetSort(bson.M{"detected_at": 1})
+
+	rows, err := f.collection.Find(ctx, bson.M{"detected_at": bson.M{"$gte": from, "$lt": to}}, opts)
+	if err != nil {
+		return response, err
+	}
+
+	if err := rows.All(ctx, &response); err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
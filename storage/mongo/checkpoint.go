@@ -0,0 +1,54 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+type checkpointStorage struct {
+	collection *mongo.Collection
+	timeouts   Timeouts
+}
+
+func NewCheckpointRepo(db *mongo.Database, timeouts Timeouts) repo.CheckpointI {
+	return &checkpointStorage{
+		collection: db.Collection(repo.CheckpointCollection),
+		timeouts:   timeouts,
+	}
+}
+
+func (f *checkpointStorage) Get(ctx context.Context, name string) (*models.Checkpoint, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
+	var (
+		response models.Checkpoint
+	)
+
+	err := f.collection.FindOne(ctx, bson.M{"_id": name}).Decode(&response)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repo.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (f *checkpointStorage) Save(ctx context.Context, req models.Checkpoint) error {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	_, err := f.collection.ReplaceOne(ctx, bson.M{"_id": req.Name}, req, options.Replace().SetUpsert(true))
+
+	return err
+}
@@ -0,0 +1,97 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+type deadLetterStorage struct {
+	collection *mongo.Collection
+	timeouts   Timeouts
+}
+
+func NewDeadLetterRepo(db *mongo.Database, timeouts Timeouts) repo.DeadLetterI {
+	return &deadLetterStorage{
+		collection: db.Collection(repo.DeadLetterCollection),
+		timeouts:   timeouts,
+	}
+}
+
+func (f *deadLetterStorage) Create(
+	ctx context.Context, req models.DeadLetter) (string, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	req.BId = primitive.NewObjectID()
+
+	_, err := f.collection.InsertOne(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	return req.BId.Hex(), nil
+}
+
+func (f *deadLetterStorage) Delete(ctx context.Context, id string) error {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	result := f.collection.FindOneAndDelete(ctx, bson.M{"_id": objID})
+
+	return result.Err()
+}
+
+func (f *deadLetterStorage) DeleteAll(ctx context.Context) (int64, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	result, err := f.collection.DeleteMany(ctx, bson.M{})
+	if err != nil {
+		return 0, err
+	}
+
+	return result.DeletedCount, nil
+}
+
+func (f *deadLetterStorage) GetAll(ctx context.Context, offset, limit int64) (
+	[]*models.DeadLetter, int32, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Count)
+	defer cancel()
+
+	var (
+		response []*models.DeadLetter
+	)
+
+	opts := options.Find()
+	opts.SetLimit(limit)
+	opts.SetSkip(offset)
+	opts.SetSort(bson.M{"created_at": 1})
+
+	count, err := f.collection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return response, 0, err
+	}
+
+	rows, err := f.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return response, 0, err
+	}
+
+	if err := rows.All(ctx, &response); err != nil {
+		return response, 0, err
+	}
+
+	return response, int32(count), nil
+}
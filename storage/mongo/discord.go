@@ -2,11 +2,12 @@ package mongo
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 
 	"github.com/Sanjar0126/wiki_change_stream/models"
 	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
@@ -14,27 +15,21 @@ import (
 
 type DiscordUserStorage struct {
 	collection *mongo.Collection
+	timeouts   Timeouts
 }
 
-func NewDiscordUserRepo(db *mongo.Database) repo.DiscordUserI {
-	wiki := DiscordUserStorage{
+func NewDiscordUserRepo(db *mongo.Database, timeouts Timeouts) repo.DiscordUserI {
+	return &DiscordUserStorage{
 		collection: db.Collection(repo.DiscordUserCollection),
+		timeouts:   timeouts,
 	}
-
-	_, err := wiki.collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
-		Keys:    bson.D{{Key: "author_id", Value: 1}},
-		Options: options.Index().SetUnique(true),
-	})
-
-	if err != nil {
-		panic(err)
-	}
-
-	return &wiki
 }
 
 func (f *DiscordUserStorage) Create(
 	ctx context.Context, req models.DiscordUser) (string, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
 	req.BId = primitive.NewObjectID()
 
 	_, err := f.collection.InsertOne(ctx, req)
@@ -47,9 +42,14 @@ func (f *DiscordUserStorage) Create(
 
 func (f *DiscordUserStorage) Update(
 	ctx context.Context, req models.DiscordUser) (string, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
 	update := bson.M{
 		"$set": bson.M{
-			"lang": req.Lang,
+			"lang":      req.Lang,
+			"project":   req.Project,
+			"languages": req.Languages,
 		},
 	}
 
@@ -66,18 +66,27 @@ func (f *DiscordUserStorage) Update(
 }
 
 func (f *DiscordUserStorage) Delete(ctx context.Context, id string) error {
-	objID, _ := primitive.ObjectIDFromHex(id)
-	result := f.collection.FindOneAndDelete(context.Background(), bson.M{"id": objID})
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
 
-	if result.Err() != nil {
-		return result.Err()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	err = f.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return repo.ErrNotFound
+	}
+
+	return err
 }
 
 func (f *DiscordUserStorage) Get(
 	ctx context.Context, id string) (*models.DiscordUser, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
 	var (
 		response models.DiscordUser
 	)
@@ -93,6 +102,9 @@ func (f *DiscordUserStorage) Get(
 
 func (f *DiscordUserStorage) GetOrCreate(
 	ctx context.Context, id string) (*models.DiscordUser, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
 	var (
 		response models.DiscordUser
 	)
@@ -103,6 +115,7 @@ func (f *DiscordUserStorage) GetOrCreate(
 		response.BId = primitive.NewObjectID()
 		response.AuthorId = id
 		response.Lang = "en"
+		response.Project = "wikipedia"
 
 		_, err = f.collection.InsertOne(ctx, response)
 	}
@@ -113,3 +126,64 @@ func (f *DiscordUserStorage) GetOrCreate(
 
 	return &response, nil
 }
+
+// SetDigest stores when the user gets a digest, nil stops it.
+func (f *DiscordUserStorage) SetDigest(
+	ctx context.Context, id string, digest *models.Digest) error {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"digest": ""}}
+	if digest != nil {
+		update = bson.M{"$set": bson.M{"digest": digest}}
+	}
+
+	result, err := f.collection.UpdateOne(ctx, bson.M{"author_id": id}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return repo.ErrNotFound
+	}
+
+	return nil
+}
+
+// GetDigestSubscribers returns the users who get a digest.
+func (f *DiscordUserStorage) GetDigestSubscribers(
+	ctx context.Context) ([]*models.DiscordUser, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
+	var (
+		response []*models.DiscordUser
+	)
+
+	rows, err := f.collection.Find(ctx, bson.M{
+		"digest.frequency": bson.M{"$in": bson.A{models.DigestDaily, models.DigestWeekly}},
+	})
+	if err != nil {
+		return response, err
+	}
+
+	if err := rows.All(ctx, &response); err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
+// MarkDigestSent records the scheduled time of the digest just sent, leaving
+// the rest of the settings as the user may have changed them meanwhile.
+func (f *DiscordUserStorage) MarkDigestSent(
+	ctx context.Context, id string, sentFor time.Time) error {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	_, err := f.collection.UpdateOne(ctx,
+		bson.M{"author_id": id, "digest": bson.M{"$exists": true}},
+		bson.M{"$set": bson.M{"digest.sent_for": sentFor}})
+
+	return err
+}
@@ -0,0 +1,57 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+type discordGuildStorage struct {
+	collection *mongo.Collection
+	timeouts   Timeouts
+}
+
+func NewDiscordGuildRepo(db *mongo.Database, timeouts Timeouts) repo.DiscordGuildI {
+	return &discordGuildStorage{
+		collection: db.Collection(repo.DiscordGuildCollection),
+		timeouts:   timeouts,
+	}
+}
+
+func (f *discordGuildStorage) Get(ctx context.Context, guildID string) (*models.DiscordGuild, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
+	var (
+		response models.DiscordGuild
+	)
+
+	err := f.collection.FindOne(ctx, bson.M{"_id": guildID}).Decode(&response)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repo.ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (f *discordGuildStorage) Save(ctx context.Context, req models.DiscordGuild) error {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	req.UpdatedAt = time.Now().UTC()
+
+	_, err := f.collection.ReplaceOne(ctx, bson.M{"_id": req.GuildID}, req, options.Replace().SetUpsert(true))
+
+	return err
+}
@@ -0,0 +1,94 @@
+package mongo
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+type discordSubscriptionStorage struct {
+	collection *mongo.Collection
+	timeouts   Timeouts
+}
+
+func NewDiscordSubscriptionRepo(db *mongo.Database, timeouts Timeouts) repo.DiscordSubscriptionI {
+	return &discordSubscriptionStorage{
+		collection: db.Collection(repo.DiscordSubscriptionCollection),
+		timeouts:   timeouts,
+	}
+}
+
+func (f *discordSubscriptionStorage) Create(
+	ctx context.Context, req models.DiscordSubscription) (string, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	req.BId = primitive.NewObjectID()
+
+	filter := bson.M{
+		"channel_id": req.ChannelID,
+		"topic":      req.Topic,
+		"wiki":       req.Wiki,
+	}
+
+	_, err := f.collection.UpdateOne(ctx, filter, bson.M{"$setOnInsert": req},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		return "", err
+	}
+
+	return req.BId.Hex(), nil
+}
+
+func (f *discordSubscriptionStorage) Delete(
+	ctx context.Context, channelID, topic, wiki string) error {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	filter := bson.M{
+		"channel_id": channelID,
+		"topic":      topic,
+		"wiki":       wiki,
+	}
+
+	_, err := f.collection.DeleteOne(ctx, filter)
+
+	return err
+}
+
+func (f *discordSubscriptionStorage) GetByTopic(
+	ctx context.Context, topic, wiki string) ([]*models.DiscordSubscription, error) {
+	return f.find(ctx, bson.M{"topic": topic, "wiki": wiki})
+}
+
+func (f *discordSubscriptionStorage) GetByChannel(
+	ctx context.Context, channelID string) ([]*models.DiscordSubscription, error) {
+	return f.find(ctx, bson.M{"channel_id": channelID})
+}
+
+func (f *discordSubscriptionStorage) find(
+	ctx context.Context, filter bson.M) ([]*models.DiscordSubscription, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
+	var (
+		response []*models.DiscordSubscription
+	)
+
+	rows, err := f.collection.Find(ctx, filter)
+	if err != nil {
+		return response, err
+	}
+
+	if err := rows.All(ctx, &response); err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
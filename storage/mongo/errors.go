@@ -0,0 +1,16 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Unreachable reports whether err means MongoDB could not be reached in
+// time, as opposed to rejecting the operation. Retrying only helps the
+// former.
+func Unreachable(err error) bool {
+	return mongo.IsNetworkError(err) || mongo.IsTimeout(err) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, mongo.ErrClientDisconnected)
+}
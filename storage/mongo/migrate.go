@@ -0,0 +1,91 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/Sanjar0126/wiki_change_stream/storage/repo"
+)
+
+var indexes = map[string][]mongo.IndexModel{
+	repo.WikiChangesCollection: {
+		{
+			Keys:    bson.D{{Key: "meta.id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "timestamp", Value: 1}},
+		},
+		{
+			Keys: bson.D{
+				{Key: "server_name", Value: 1},
+				{Key: "id", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "server_name", Value: 1},
+				{Key: "revision.new", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "log_type", Value: 1},
+				{Key: "timestamp", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
+	},
+	repo.DiscordUserCollection: {
+		{
+			Keys:    bson.D{{Key: "author_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "digest.frequency", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	},
+	repo.DiscordSubscriptionCollection: {
+		{
+			Keys: bson.D{
+				{Key: "channel_id", Value: 1},
+				{Key: "topic", Value: 1},
+				{Key: "wiki", Value: 1},
+			},
+			Options: options.Index().SetUnique(true),
+		},
+	},
+	repo.EditWarCollection: {
+		{
+			Keys: bson.D{
+				{Key: "wiki", Value: 1},
+				{Key: "detected_at", Value: -1},
+			},
+		},
+		{
+			Keys: bson.D{{Key: "detected_at", Value: 1}},
+		},
+	},
+	repo.DeadLetterCollection: {
+		{
+			Keys: bson.D{{Key: "created_at", Value: 1}},
+		},
+	},
+}
+
+// Migrate creates the indexes every collection relies on. It is safe to run
+// repeatedly, existing indexes are left untouched.
+func Migrate(ctx context.Context, db *mongo.Database) error {
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("error creating indexes for %s: %w", collection, err)
+		}
+	}
+
+	return nil
+}
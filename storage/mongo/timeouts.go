@@ -0,0 +1,25 @@
+package mongo
+
+import (
+	"context"
+	"time"
+)
+
+// Timeouts bound single storage operations on top of the caller's context,
+// zero leaves the context alone. Stream is only bounded by the caller since
+// it runs as long as the consumer keeps reading.
+type Timeouts struct {
+	Read  time.Duration
+	Write time.Duration
+	// Count applies to counting queries, which scan far more documents
+	// than a lookup.
+	Count time.Duration
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
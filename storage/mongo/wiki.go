@@ -2,6 +2,7 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -16,30 +17,28 @@ import (
 
 type wikiChangesStorage struct {
 	collection *mongo.Collection
+	timeouts   Timeouts
 }
 
-func NewWikiChangesRepo(db *mongo.Database) repo.WikiChangesI {
-	wiki := wikiChangesStorage{
+func NewWikiChangesRepo(db *mongo.Database, timeouts Timeouts) repo.WikiChangesI {
+	return &wikiChangesStorage{
 		collection: db.Collection(repo.WikiChangesCollection),
+		timeouts:   timeouts,
 	}
-
-	_, err := wiki.collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
-		Keys:    bson.D{{Key: "meta.id", Value: 1}},
-		Options: options.Index().SetUnique(true),
-	})
-
-	if err != nil {
-		panic(err)
-	}
-
-	return &wiki
 }
 
 func (f *wikiChangesStorage) Create(
 	ctx context.Context, req models.WikiRecentChanges) (string, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
 	req.BId = primitive.NewObjectID()
 
 	_, err := f.collection.InsertOne(ctx, req)
+	if mongo.IsDuplicateKeyError(err) {
+		return "", fmt.Errorf("%w: %s", repo.ErrDuplicate, req.Meta.ID)
+	}
+
 	if err != nil {
 		return "", err
 	}
@@ -47,58 +46,151 @@ func (f *wikiChangesStorage) Create(
 	return req.BId.Hex(), nil
 }
 
+// CreateMany inserts a batch unordered, so one change already stored under
+// the same meta.id is skipped without stopping the rest of the batch.
+func (f *wikiChangesStorage) CreateMany(
+	ctx context.Context, req []models.WikiRecentChanges) (inserted, skipped int, err error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
+
+	if len(req) == 0 {
+		return 0, 0, nil
+	}
+
+	documents := make([]interface{}, 0, len(req))
+
+	for i := range req {
+		if req[i].BId.IsZero() {
+			req[i].BId = primitive.NewObjectID()
+		}
+
+		documents = append(documents, req[i])
+	}
+
+	result, err := f.collection.InsertMany(ctx, documents, options.InsertMany().SetOrdered(false))
+	if result != nil {
+		inserted = len(result.InsertedIDs)
+	}
+
+	var bulkErr mongo.BulkWriteException
+	if errors.As(err, &bulkErr) && bulkErr.WriteConcernError == nil {
+		for _, writeErr := range bulkErr.WriteErrors {
+			if !mongo.IsDuplicateKeyError(writeErr) {
+				return inserted, skipped, err
+			}
+
+			skipped++
+		}
+
+		inserted = len(req) - skipped
+
+		return inserted, skipped, nil
+	}
+
+	return inserted, skipped, err
+}
+
 func (f *wikiChangesStorage) Delete(ctx context.Context, id string) error {
-	objID, _ := primitive.ObjectIDFromHex(id)
-	result := f.collection.FindOneAndDelete(context.Background(), bson.M{"id": objID})
+	ctx, cancel := withTimeout(ctx, f.timeouts.Write)
+	defer cancel()
 
-	if result.Err() != nil {
-		return result.Err()
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	err = f.collection.FindOneAndDelete(ctx, bson.M{"_id": objectID}).Err()
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return repo.ErrNotFound
+	}
+
+	return err
 }
 
+// Get looks a change up by the object id it was stored under.
 func (f *wikiChangesStorage) Get(
 	ctx context.Context, id string) (*models.WikiRecentChanges, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return f.findOne(ctx, bson.M{"_id": objectID})
+}
+
+// GetByMetaID looks a change up by the event id assigned by EventStreams.
+func (f *wikiChangesStorage) GetByMetaID(
+	ctx context.Context, metaID string) (*models.WikiRecentChanges, error) {
+	return f.findOne(ctx, bson.M{"meta.id": metaID})
+}
+
+// GetByRCID looks a change up by its recent changes id, which is only unique
+// within one wiki.
+func (f *wikiChangesStorage) GetByRCID(
+	ctx context.Context, serverName string, id int64) (*models.WikiRecentChanges, error) {
+	return f.findOne(ctx, bson.M{"server_name": serverName, "id": id})
+}
+
+// GetByRevision looks up the edit that created the given revision.
+func (f *wikiChangesStorage) GetByRevision(
+	ctx context.Context, serverName string, revision int64) (*models.WikiRecentChanges, error) {
+	return f.findOne(ctx, bson.M{"server_name": serverName, "revision.new": revision})
+}
+
+func (f *wikiChangesStorage) findOne(
+	ctx context.Context, filter bson.M) (*models.WikiRecentChanges, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
 	var (
 		response models.WikiRecentChanges
 	)
 
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		return nil, err
+	err := f.collection.FindOne(ctx, filter).Decode(&response)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, repo.ErrNotFound
 	}
 
-	if err = f.collection.FindOne(
-		ctx,
-		bson.M{"id": objectID}).Decode(&response); err != nil {
+	if err != nil {
 		return nil, err
 	}
 
 	return &response, nil
 }
 
-func (f *wikiChangesStorage) GetLatest() string {
+// GetLatest returns the time of the newest stored change, zero when nothing
+// is stored yet.
+func (f *wikiChangesStorage) GetLatest(ctx context.Context) (time.Time, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
 	var (
 		response models.WikiRecentChanges
 	)
 
-	findOptions := options.FindOne().SetSort(bson.D{{"timestamp", -1}})
+	findOptions := options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})
 
-	if err := f.collection.FindOne(
-		context.Background(),
-		bson.M{}, findOptions).Decode(&response); err != nil {
-		return ""
+	err := f.collection.FindOne(ctx, bson.M{}, findOptions).Decode(&response)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return time.Time{}, nil
 	}
 
-	return fmt.Sprintf("%d", response.Timestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return response.Time(), nil
 }
 
-func (f *wikiChangesStorage) GetCountDate(dateStr, lang string) (int64, error) {
+func (f *wikiChangesStorage) GetCountDate(ctx context.Context, dateStr string,
+	filter models.WikiChangesFilter) (int64, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Count)
+	defer cancel()
+
 	layout := "2006-01-02"
 
-	if lang == "" {
-		lang = "en"
+	if filter.Lang == "" && len(filter.Languages) == 0 && filter.Project == "" {
+		filter.Lang = "en"
 	}
 
 	date, err := time.Parse(layout, dateStr)
@@ -106,24 +198,20 @@ func (f *wikiChangesStorage) GetCountDate(dateStr, lang string) (int64, error) {
 		return 0, err
 	}
 
-	startTimestamp := date.Unix()
-	endTimestamp := date.Add(24 * time.Hour).Add(-1 * time.Second).Unix()
+	filter.From = date
+	filter.To = date.Add(24 * time.Hour)
 
-	filter := bson.M{
-		"server_prefix": lang,
-		"timestamp": bson.M{
-			"$gte": startTimestamp,
-			"$lte": endTimestamp,
-		},
-	}
-
-	count, err := f.collection.CountDocuments(context.Background(), filter)
+	count, err := f.collection.CountDocuments(ctx, changesFilter(filter))
 
 	return count, err
 }
 
-func (f *wikiChangesStorage) GetAll(ctx context.Context, offset, limit int64, lang string) (
+func (f *wikiChangesStorage) GetAll(
+	ctx context.Context, offset, limit int64, filter models.WikiChangesFilter) (
 	[]*models.WikiRecentChanges, int32, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Count)
+	defer cancel()
+
 	var (
 		response []*models.WikiRecentChanges
 	)
@@ -131,17 +219,22 @@ func (f *wikiChangesStorage) GetAll(ctx context.Context, offset, limit int64, la
 	opts := options.Find()
 	opts.SetLimit(limit)
 	opts.SetSkip(offset)
-	opts.SetSort(bson.M{"timestamp": 1})
+	order := 1
+	if filter.Newest {
+		order = -1
+	}
+
+	opts.SetSort(bson.M{"timestamp": order})
 
-	filtering := bson.M{"server_prefix": lang}
+	filtering := changesFilter(filter)
 
-	count, err := f.collection.CountDocuments(context.Background(), filtering)
+	count, err := f.collection.CountDocuments(ctx, filtering)
 	if err != nil {
 		return response, 0, err
 	}
 
 	rows, err := f.collection.Find(
-		context.Background(),
+		ctx,
 		filtering,
 		opts,
 	)
@@ -149,9 +242,267 @@ func (f *wikiChangesStorage) GetAll(ctx context.Context, offset, limit int64, la
 		return response, 0, err
 	}
 
-	if err := rows.All(context.Background(), &response); err != nil {
+	if err := rows.All(ctx, &response); err != nil {
 		return response, 0, err
 	}
 
 	return response, int32(count), nil
 }
+
+// GetSites counts the changes per wiki prefix and project since the given
+// time, most active first.
+func (f *wikiChangesStorage) GetSites(ctx context.Context, since time.Time) ([]models.WikiSite, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Count)
+	defer cancel()
+
+	var (
+		response []models.WikiSite
+	)
+
+	rows, err := f.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"timestamp": bson.M{"$gte": since.Unix()}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":     bson.M{"prefix": "$server_prefix", "project": "$project"},
+			"changes": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":     0,
+			"prefix":  "$_id.prefix",
+			"project": "$_id.project",
+			"changes": 1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "changes", Value: -1}, {Key: "prefix", Value: 1}}}},
+	})
+	if err != nil {
+		return response, err
+	}
+
+	if err := rows.All(ctx, &response); err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
+// GetDigest summarizes the changes matching the filter in one aggregation:
+// totals, the most edited pages and the latest new articles, limit each, and
+// the number of log events per type and action.
+func (f *wikiChangesStorage) GetDigest(ctx context.Context, filter models.WikiChangesFilter,
+	limit int64) (*models.WikiDigest, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Count)
+	defer cancel()
+
+	countType := func(changeType string) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{"$type", changeType}}, 1, 0}}}
+	}
+
+	page := bson.M{
+		"_id":         0,
+		"server_name": "$_id.server_name",
+		"title":       "$_id.title",
+		"title_url":   1,
+		"edits":       1,
+	}
+
+	rows, err := f.collection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: changesFilter(filter)}},
+		{{Key: "$facet", Value: bson.M{
+			"totals": bson.A{
+				bson.M{"$group": bson.M{
+					"_id":       nil,
+					"changes":   bson.M{"$sum": 1},
+					"edits":     countType("edit"),
+					"new_pages": countType("new"),
+					"logs":      countType("log"),
+					"bots":      bson.M{"$sum": bson.M{"$cond": bson.A{"$bot", 1, 0}}},
+				}},
+			},
+			"users": bson.A{
+				bson.M{"$group": bson.M{"_id": "$user"}},
+				bson.M{"$count": "users"},
+			},
+			"top_pages": bson.A{
+				bson.M{"$match": bson.M{"type": "edit"}},
+				bson.M{"$group": bson.M{
+					"_id":       bson.M{"server_name": "$server_name", "title": "$title"},
+					"title_url": bson.M{"$last": "$title_url"},
+					"edits":     bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.D{{Key: "edits", Value: -1}, {Key: "_id.title", Value: 1}}},
+				bson.M{"$limit": limit},
+				bson.M{"$project": page},
+			},
+			"created": bson.A{
+				bson.M{"$match": bson.M{"type": "new", "namespace": 0}},
+				bson.M{"$sort": bson.M{"timestamp": -1}},
+				bson.M{"$limit": limit},
+				bson.M{"$project": bson.M{"_id": 0, "server_name": 1, "title": 1, "title_url": 1}},
+			},
+			"log_actions": bson.A{
+				bson.M{"$match": bson.M{"type": "log"}},
+				bson.M{"$group": bson.M{
+					"_id":   bson.M{"log_type": "$log_type", "log_action": "$log_action"},
+					"count": bson.M{"$sum": 1},
+				}},
+				bson.M{"$sort": bson.M{"count": -1}},
+				bson.M{"$project": bson.M{
+					"_id":        0,
+					"log_type":   "$_id.log_type",
+					"log_action": "$_id.log_action",
+					"count":      1,
+				}},
+			},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var facets []struct {
+		Totals     []models.WikiDigest     `bson:"totals"`
+		Users      []struct{ Users int64 } `bson:"users"`
+		TopPages   []models.WikiPageEdits  `bson:"top_pages"`
+		Created    []models.WikiPageEdits  `bson:"created"`
+		LogActions []models.WikiLogCount   `bson:"log_actions"`
+	}
+
+	if err := rows.All(ctx, &facets); err != nil {
+		return nil, err
+	}
+
+	var response models.WikiDigest
+
+	if len(facets) == 0 {
+		return &response, nil
+	}
+
+	if len(facets[0].Totals) > 0 {
+		response = facets[0].Totals[0]
+	}
+
+	if len(facets[0].Users) > 0 {
+		response.Users = facets[0].Users[0].Users
+	}
+
+	response.TopPages = facets[0].TopPages
+	response.Created = facets[0].Created
+	response.LogActions = facets[0].LogActions
+
+	return &response, nil
+}
+
+// GetAfter returns changes stored after the given object id in insertion
+// order, which lets other processes tail the collection.
+func (f *wikiChangesStorage) GetAfter(
+	ctx context.Context, id string, limit int64) ([]*models.WikiRecentChanges, error) {
+	ctx, cancel := withTimeout(ctx, f.timeouts.Read)
+	defer cancel()
+
+	var (
+		response []*models.WikiRecentChanges
+	)
+
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find()
+	opts.SetLimit(limit)
+	opts.SetSort(bson.M{"_id": 1})
+
+	rows, err := f.collection.Find(ctx, bson.M{"_id": bson.M{"$gt": objectID}}, opts)
+	if err != nil {
+		return response, err
+	}
+
+	if err := rows.All(ctx, &response); err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
+
+// Stream walks every change matching the filter in timestamp order with a
+// cursor, so the whole result never has to fit in memory.
+func (f *wikiChangesStorage) Stream(ctx context.Context, filter models.WikiChangesFilter,
+	fn func(*models.WikiRecentChanges) error) error {
+	opts := options.Find()
+	opts.SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	opts.SetBatchSize(1000)
+
+	cursor, err := f.collection.Find(ctx, changesFilter(filter), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var change models.WikiRecentChanges
+
+		if err := cursor.Decode(&change); err != nil {
+			return err
+		}
+
+		if err := fn(&change); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func changesFilter(filter models.WikiChangesFilter) bson.M {
+	filtering := bson.M{}
+
+	if filter.Lang != "" {
+		filtering["server_prefix"] = filter.Lang
+	}
+
+	if filter.Project != "" {
+		filtering["project"] = filter.Project
+	}
+
+	if len(filter.Languages) > 0 {
+		languages := make(bson.A, 0, len(filter.Languages))
+
+		for _, language := range filter.Languages {
+			match := bson.M{"server_prefix": language.Lang}
+			if language.Project != "" {
+				match["project"] = language.Project
+			}
+
+			languages = append(languages, match)
+		}
+
+		filtering["$or"] = languages
+	}
+
+	if filter.Type != "" {
+		filtering["type"] = filter.Type
+	}
+
+	if filter.LogType != "" {
+		filtering["log_type"] = filter.LogType
+	}
+
+	if filter.LogAction != "" {
+		filtering["log_action"] = filter.LogAction
+	}
+
+	timestamp := bson.M{}
+
+	if !filter.From.IsZero() {
+		timestamp["$gte"] = filter.From.Unix()
+	}
+
+	if !filter.To.IsZero() {
+		timestamp["$lt"] = filter.To.Unix()
+	}
+
+	if len(timestamp) > 0 {
+		filtering["timestamp"] = timestamp
+	}
+
+	return filtering
+}
@@ -0,0 +1,19 @@
+package repo
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+var (
+	EditWarCollection = "edit_war_incidents"
+)
+
+type EditWarI interface {
+	Create(ctx context.Context, req models.EditWarIncident) (string, error)
+	GetAll(ctx context.Context, offset, limit int64, wiki string) (
+		[]*models.EditWarIncident, int32, error)
+	GetDetected(ctx context.Context, from, to time.Time) ([]*models.EditWarIncident, error)
+}
@@ -0,0 +1,16 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+var (
+	CheckpointCollection = "checkpoints"
+)
+
+type CheckpointI interface {
+	Get(ctx context.Context, name string) (*models.Checkpoint, error)
+	Save(ctx context.Context, req models.Checkpoint) error
+}
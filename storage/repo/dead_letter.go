@@ -0,0 +1,18 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+var (
+	DeadLetterCollection = "dead_letters"
+)
+
+type DeadLetterI interface {
+	Create(ctx context.Context, req models.DeadLetter) (string, error)
+	Delete(ctx context.Context, id string) error
+	DeleteAll(ctx context.Context) (int64, error)
+	GetAll(ctx context.Context, offset, limit int64) ([]*models.DeadLetter, int32, error)
+}
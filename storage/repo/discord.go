@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"github.com/Sanjar0126/wiki_change_stream/models"
 )
@@ -16,4 +17,7 @@ type DiscordUserI interface {
 	Delete(ctx context.Context, id string) error
 	Get(ctx context.Context, id string) (*models.DiscordUser, error)
 	GetOrCreate(ctx context.Context, id string) (*models.DiscordUser, error)
+	SetDigest(ctx context.Context, id string, digest *models.Digest) error
+	GetDigestSubscribers(ctx context.Context) ([]*models.DiscordUser, error)
+	MarkDigestSent(ctx context.Context, id string, sentFor time.Time) error
 }
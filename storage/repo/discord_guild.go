@@ -0,0 +1,16 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+var (
+	DiscordGuildCollection = "discord_guilds"
+)
+
+type DiscordGuildI interface {
+	Get(ctx context.Context, guildID string) (*models.DiscordGuild, error)
+	Save(ctx context.Context, req models.DiscordGuild) error
+}
@@ -0,0 +1,24 @@
+package repo
+
+import (
+	"context"
+
+	"github.com/Sanjar0126/wiki_change_stream/models"
+)
+
+var (
+	DiscordSubscriptionCollection = "discord_subscriptions"
+)
+
+const (
+	TopicTrending  = "trending"
+	TopicEditWar   = "editwar"
+	TopicVandalism = "vandalism"
+)
+
+type DiscordSubscriptionI interface {
+	Create(ctx context.Context, req models.DiscordSubscription) (string, error)
+	Delete(ctx context.Context, channelID, topic, wiki string) error
+	GetByTopic(ctx context.Context, topic, wiki string) ([]*models.DiscordSubscription, error)
+	GetByChannel(ctx context.Context, channelID string) ([]*models.DiscordSubscription, error)
+}
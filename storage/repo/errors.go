@@ -0,0 +1,11 @@
+package repo
+
+import "errors"
+
+var (
+	// ErrNotFound is returned by lookups and deletes that match no document.
+	ErrNotFound = errors.New("not found")
+	// ErrDuplicate is returned when a document with the same unique key is
+	// already stored.
+	ErrDuplicate = errors.New("already stored")
+)
@@ -2,6 +2,7 @@ package repo
 
 import (
 	"context"
+	"time"
 
 	"github.com/Sanjar0126/wiki_change_stream/models"
 )
@@ -12,10 +13,19 @@ var (
 
 type WikiChangesI interface {
 	Create(ctx context.Context, req models.WikiRecentChanges) (string, error)
+	CreateMany(ctx context.Context, req []models.WikiRecentChanges) (inserted, skipped int, err error)
 	Delete(ctx context.Context, id string) error
 	Get(ctx context.Context, id string) (*models.WikiRecentChanges, error)
-	GetLatest() string
-	GetCountDate(dateStr, lang string) (int64, error)
-	GetAll(ctx context.Context, offset, limit int64, lang string) (
+	GetByMetaID(ctx context.Context, metaID string) (*models.WikiRecentChanges, error)
+	GetByRCID(ctx context.Context, serverName string, id int64) (*models.WikiRecentChanges, error)
+	GetByRevision(ctx context.Context, serverName string, revision int64) (*models.WikiRecentChanges, error)
+	GetLatest(ctx context.Context) (time.Time, error)
+	GetCountDate(ctx context.Context, dateStr string, filter models.WikiChangesFilter) (int64, error)
+	GetAll(ctx context.Context, offset, limit int64, filter models.WikiChangesFilter) (
 		[]*models.WikiRecentChanges, int32, error)
+	GetSites(ctx context.Context, since time.Time) ([]models.WikiSite, error)
+	GetDigest(ctx context.Context, filter models.WikiChangesFilter, limit int64) (*models.WikiDigest, error)
+	GetAfter(ctx context.Context, id string, limit int64) ([]*models.WikiRecentChanges, error)
+	Stream(ctx context.Context, filter models.WikiChangesFilter,
+		fn func(*models.WikiRecentChanges) error) error
 }